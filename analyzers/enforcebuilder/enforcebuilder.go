@@ -0,0 +1,271 @@
+// Package enforcebuilder defines an Analyzer reporting composite literals
+// of structs annotated @builder:enforce outside their package, so their
+// defaults and validation cannot be bypassed.
+package enforcebuilder
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+	"github.com/nanostack-dev/generators/internal/cli"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const doc = `report composite literals of @builder:enforce structs
+
+Structs annotated @builder:enforce are built through their generated
+builder outside the package declaring them. enforcebuilder reports their
+composite literals elsewhere, generated files and tests aside, and suggests
+the equivalent builder chain:
+
+	model.Person{Name: name}
+
+becomes
+
+	*model.NewPersonBuilder().WithName(name).Build()`
+
+// Analyzer reports composite literals bypassing an enforced builder.
+var Analyzer = &analysis.Analyzer{
+	Name:      "enforcebuilder",
+	Doc:       doc,
+	Run:       run,
+	FactTypes: []analysis.Fact{new(enforced)},
+}
+
+// enforced marks the type name of a struct annotated @builder:enforce.
+type enforced struct {
+	// Constructor is the name of the builder constructor, empty when the
+	// builder is not generated in the package of the struct.
+	Constructor string
+	// Validate is set when the struct is checked by BuildValidated, which
+	// a chain ending with Build would skip.
+	Validate bool
+	// Setters holds the setter name of each field having one.
+	Setters map[string]string
+}
+
+func (*enforced) AFact() {}
+
+func (f *enforced) String() string {
+	if f.Validate {
+		return "enforced(" + f.Constructor + ", validate)"
+	}
+	return "enforced(" + f.Constructor + ")"
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	exportFacts(pass)
+
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Package).Filename
+		if ast.IsGenerated(file) || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+
+		// &T{...} is rewritten as a whole, the literal alone being a T
+		addressed := make(map[*ast.CompositeLit]*ast.UnaryExpr)
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.UnaryExpr:
+				if lit, ok := n.X.(*ast.CompositeLit); ok && n.Op == token.AND {
+					addressed[lit] = n
+				}
+			case *ast.CompositeLit:
+				checkLiteral(pass, file, n, addressed[n])
+			}
+			return true
+		})
+	}
+	return nil, nil
+}
+
+// exportFacts marks the structs of the package annotated @builder:enforce.
+func exportFacts(pass *analysis.Pass) {
+	var structDefs []*genparser.StructDef
+	dir := ""
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Package).Filename
+		if ast.IsGenerated(file) || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		dir = filepath.Dir(filename)
+		for _, structDef := range genparser.ParseStructs(pass.Fset, file) {
+			if structDef.Annotations.Enforce && structDef.Annotations.Builder && !structDef.Annotations.Skip {
+				structDefs = append(structDefs, structDef)
+			}
+		}
+	}
+	if len(structDefs) == 0 {
+		return
+	}
+
+	// Planning resolves the settings of the structs, among them the prefix
+	// of their setters; settings errors are for the generator to report
+	planned, _ := cli.Plan(dir, structDefs, nil)
+	inReach := make(map[string]bool)
+	for _, file := range planned {
+		if file.Generator != "builder" || filepath.Dir(file.Path) != dir {
+			continue
+		}
+		for _, structDef := range file.Types {
+			if structDef.Annotations.Package == "" || structDef.Annotations.Package == pass.Pkg.Name() {
+				inReach[structDef.Name] = true
+			}
+		}
+	}
+
+	for _, structDef := range structDefs {
+		obj, ok := pass.Pkg.Scope().Lookup(structDef.Name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		fact := &enforced{Setters: make(map[string]string)}
+		var methods *types.MethodSet
+		if inReach[structDef.Name] {
+			fact.Constructor = "New" + structDef.Name + "Builder"
+			if structDef.Annotations.Constructor != "" {
+				fact.Constructor = structDef.Annotations.Constructor
+			}
+			fact.Validate = structDef.Annotations.Validate
+			if builder, ok := pass.Pkg.Scope().Lookup(structDef.Name + "Builder").(*types.TypeName); ok {
+				methods = types.NewMethodSet(types.NewPointer(builder.Type()))
+			}
+		}
+		for _, field := range structDef.Fields {
+			// The flags of a go:generate line may have named the setters
+			// otherwise, so only those found on the builder are kept
+			setter, ok := generator.SetterName(structDef, field)
+			if ok && methods != nil && methods.Lookup(pass.Pkg, setter) != nil {
+				fact.Setters[field.Name] = setter
+			}
+		}
+		pass.ExportObjectFact(obj, fact)
+	}
+}
+
+// checkLiteral reports lit when it is a literal of an enforced struct of
+// another package, addr being the expression taking its address if any.
+func checkLiteral(pass *analysis.Pass, file *ast.File, lit *ast.CompositeLit, addr *ast.UnaryExpr) {
+	t := types.Unalias(pass.TypesInfo.TypeOf(lit))
+	// An elided type within a literal of pointers stands for &T{...}
+	pointer := false
+	if ptr, ok := t.(*types.Pointer); ok {
+		t, pointer = ptr.Elem(), true
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg() == pass.Pkg {
+		return
+	}
+	var fact enforced
+	if !pass.ImportObjectFact(named.Obj(), &fact) {
+		return
+	}
+
+	diag := analysis.Diagnostic{
+		Pos:     lit.Pos(),
+		End:     lit.End(),
+		Message: named.Obj().Name() + " is built with a composite literal: use its builder",
+	}
+	if fact.Constructor != "" {
+		diag.Message = named.Obj().Name() + " is built with a composite literal: use " + fact.Constructor
+		var expr ast.Expr = lit
+		if addr != nil {
+			expr, pointer = addr, true
+		}
+		if chain, ok := builderChain(pass, file, lit, named, &fact); ok {
+			if !pointer {
+				chain = "*" + chain
+			}
+			diag.SuggestedFixes = []analysis.SuggestedFix{{
+				Message: "Use " + fact.Constructor,
+				TextEdits: []analysis.TextEdit{{
+					Pos:     expr.Pos(),
+					End:     expr.End(),
+					NewText: []byte(chain),
+				}},
+			}}
+		}
+	}
+	pass.Report(diag)
+}
+
+// builderChain returns the builder chain building the same value as lit,
+// and false when a field of lit has no setter, the package of the builder
+// is not imported by file or the struct is validated, BuildValidated
+// returning an error to handle.
+func builderChain(pass *analysis.Pass, file *ast.File, lit *ast.CompositeLit, named *types.Named, fact *enforced) (string, bool) {
+	strct, ok := named.Underlying().(*types.Struct)
+	if !ok || fact.Validate {
+		return "", false
+	}
+	qualifier, ok := packageName(file, lit, named.Obj().Pkg())
+	if !ok {
+		return "", false
+	}
+
+	var chain strings.Builder
+	chain.WriteString(qualifier + fact.Constructor + "()")
+	for i, elt := range lit.Elts {
+		name := ""
+		value := elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return "", false
+			}
+			name, value = key.Name, kv.Value
+		} else if i < strct.NumFields() {
+			name = strct.Field(i).Name()
+		}
+		setter, ok := fact.Setters[name]
+		if !ok {
+			return "", false
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, pass.Fset, value); err != nil {
+			return "", false
+		}
+		chain.WriteString("." + setter + "(" + buf.String() + ")")
+	}
+	chain.WriteString(".Build()")
+	return chain.String(), true
+}
+
+// packageName returns the qualifier, with its dot, naming pkg in file.
+func packageName(file *ast.File, lit *ast.CompositeLit, pkg *types.Package) (string, bool) {
+	typ := lit.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if sel, ok := typ.(*ast.SelectorExpr); ok {
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			return ident.Name + ".", true
+		}
+	}
+
+	// The type is elided or dot imported
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != pkg.Path() {
+			continue
+		}
+		switch {
+		case spec.Name == nil:
+			return pkg.Name() + ".", true
+		case spec.Name.Name == ".":
+			return "", true
+		case spec.Name.Name != "_":
+			return spec.Name.Name + ".", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"model"
+)
+
+func people(name string) []*model.Person {
+	ada := model.Person{Name: "Ada", Age: 36} // want "Person is built with a composite literal: use NewPersonBuilder"
+	bob := &model.Person{Name: name}          // want "Person is built with a composite literal: use NewPersonBuilder"
+	eve := model.Person{"Eve", 1 + 1}         // want "Person is built with a composite literal: use NewPersonBuilder"
+	return append([]*model.Person{
+		{Name: "Joe"}, // want "Person is built with a composite literal: use NewPersonBuilder"
+	}, &ada, bob, &eve)
+}
+
+func crowd() []model.Person {
+	return []model.Person{
+		{}, // want "Person is built with a composite literal: use NewPersonBuilder"
+	}
+}
+
+func team(lead *model.Person) model.Team {
+	return model.Team{Name: "core", Lead: lead} // want "Team is built with a composite literal: use NewTeamBuilder"
+}
+
+func account() model.Account {
+	// Password has no generated setter, so no fix is suggested
+	return model.Account{Login: "ada", Password: "secret"} // want "Account is built with a composite literal: use NewAccountBuilder"
+}
+
+func member() model.Member {
+	// BuildValidated returns an error to handle, so no fix is suggested
+	return model.Member{Email: "ada@example.com"} // want "Member is built with a composite literal: use NewMemberBuilder"
+}
+
+func crew() model.Crew {
+	// WithName is not a method of the builder, so no fix is suggested
+	return model.Crew{Name: "core"} // want "Crew is built with a composite literal: use NewCrewBuilder"
+}
+
+func pet() model.Pet {
+	return model.Pet{Name: "Rex"}
+}
@@ -0,0 +1,15 @@
+package app
+
+import (
+	"testing"
+
+	"model"
+)
+
+func TestPeople(t *testing.T) {
+	// Tests may build fixtures with literals
+	want := model.Person{Name: "Ada"}
+	if got := people("Ada"); got[2].Name != want.Name {
+		t.Errorf("got %v, want %v", got[2], want)
+	}
+}
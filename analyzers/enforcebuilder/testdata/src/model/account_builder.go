@@ -0,0 +1,28 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:dc3e18b6f3df4bb4e6e5cc48e4b652e220553c188d32f492d126474e0ab629ef
+
+package model
+
+type AccountBuilder struct {
+	instance *Account
+}
+
+func NewAccountBuilder() *AccountBuilder {
+	return &AccountBuilder{instance: &Account{}}
+}
+func (p *Account) ToBuilder() *AccountBuilder {
+	if p == nil {
+		return NewAccountBuilder()
+	}
+	return &AccountBuilder{instance: &Account{Login: p.Login, Password: p.Password}}
+}
+func (b *AccountBuilder) WithLogin(login string) *AccountBuilder {
+	b.instance.Login = login
+	return b
+}
+func (b *AccountBuilder) Build() *Account {
+	return b.instance
+}
+func (b *AccountBuilder) BuildAsPtr() *Account {
+	return b.instance
+}
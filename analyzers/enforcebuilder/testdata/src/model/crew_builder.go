@@ -0,0 +1,29 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:a40396a20c6a2c57169a46a2fa267ba30c90da73e4f5194d62ad317583e6d28f
+// Generator flags: -prefix=Set
+
+package model
+
+type CrewBuilder struct {
+	instance *Crew
+}
+
+func NewCrewBuilder() *CrewBuilder {
+	return &CrewBuilder{instance: &Crew{}}
+}
+func (p *Crew) ToBuilder() *CrewBuilder {
+	if p == nil {
+		return NewCrewBuilder()
+	}
+	return &CrewBuilder{instance: &Crew{Name: p.Name}}
+}
+func (b *CrewBuilder) SetName(name string) *CrewBuilder {
+	b.instance.Name = name
+	return b
+}
+func (b *CrewBuilder) Build() *Crew {
+	return b.instance
+}
+func (b *CrewBuilder) BuildAsPtr() *Crew {
+	return b.instance
+}
@@ -0,0 +1,43 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:d776b1117bf3a95c18b6f2509010e3ffdcb4fa9f59541a0a800a7224f1366c67
+
+package model
+
+import "errors"
+
+type MemberBuilder struct {
+	instance *Member
+}
+
+func NewMemberBuilder() *MemberBuilder {
+	return &MemberBuilder{instance: &Member{}}
+}
+func (p *Member) ToBuilder() *MemberBuilder {
+	if p == nil {
+		return NewMemberBuilder()
+	}
+	return &MemberBuilder{instance: &Member{Email: p.Email}}
+}
+func (b *MemberBuilder) WithEmail(email string) *MemberBuilder {
+	b.instance.Email = email
+	return b
+}
+func (b *MemberBuilder) Build() *Member {
+	return b.instance
+}
+func (b *MemberBuilder) BuildAsPtr() *Member {
+	return b.instance
+}
+func (b *MemberBuilder) Validate() error {
+	p := b.instance
+	if p.Email == "" {
+		return errors.New("Member.Email is required")
+	}
+	return nil
+}
+func (b *MemberBuilder) BuildValidated() (*Member, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b.instance, nil
+}
@@ -0,0 +1,58 @@
+package model
+
+// Person is built through its builder outside this package.
+//
+// @builder
+// @builder:enforce
+type Person struct {
+	Name string
+	Age  int `default:"18"`
+}
+
+// Team has its own setter prefix.
+//
+// @builder
+// @builder:enforce
+// @builder:prefix Set
+type Team struct {
+	Name string
+	Lead *Person
+}
+
+// Account sets its password by hand.
+//
+// @builder
+// @builder:enforce
+// @builder:custom Password
+type Account struct {
+	Login    string
+	Password string
+}
+
+// Member is validated when built.
+//
+// @builder
+// @builder:enforce
+// @builder:validate
+type Member struct {
+	Email string `validate:"required"`
+}
+
+// Crew has its builder generated with -prefix Set, which the
+// configuration does not tell.
+//
+// @builder
+// @builder:enforce
+type Crew struct {
+	Name string
+}
+
+// Pet may be built with a literal.
+//
+// @builder
+type Pet struct {
+	Name string
+}
+
+// Founder is declared where literals are allowed.
+var Founder = Person{Name: "Ada"}
@@ -0,0 +1,32 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:1f3830da8b3b43e55861f11e1d1ee2c59bf36440460cddb8ea507f4ded38d2f4
+
+package model
+
+type PersonBuilder struct {
+	instance *Person
+}
+
+func NewPersonBuilder() *PersonBuilder {
+	return &PersonBuilder{instance: &Person{Age: 18}}
+}
+func (p *Person) ToBuilder() *PersonBuilder {
+	if p == nil {
+		return NewPersonBuilder()
+	}
+	return &PersonBuilder{instance: &Person{Name: p.Name, Age: p.Age}}
+}
+func (b *PersonBuilder) WithName(name string) *PersonBuilder {
+	b.instance.Name = name
+	return b
+}
+func (b *PersonBuilder) WithAge(age int) *PersonBuilder {
+	b.instance.Age = age
+	return b
+}
+func (b *PersonBuilder) Build() *Person {
+	return b.instance
+}
+func (b *PersonBuilder) BuildAsPtr() *Person {
+	return b.instance
+}
@@ -0,0 +1,28 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:b7fccedd5beee28d670477764a292c29e561815cbb669294d0fb933b67179ed4
+
+package model
+
+type PetBuilder struct {
+	instance *Pet
+}
+
+func NewPetBuilder() *PetBuilder {
+	return &PetBuilder{instance: &Pet{}}
+}
+func (p *Pet) ToBuilder() *PetBuilder {
+	if p == nil {
+		return NewPetBuilder()
+	}
+	return &PetBuilder{instance: &Pet{Name: p.Name}}
+}
+func (b *PetBuilder) WithName(name string) *PetBuilder {
+	b.instance.Name = name
+	return b
+}
+func (b *PetBuilder) Build() *Pet {
+	return b.instance
+}
+func (b *PetBuilder) BuildAsPtr() *Pet {
+	return b.instance
+}
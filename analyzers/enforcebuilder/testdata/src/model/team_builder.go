@@ -0,0 +1,32 @@
+// Code generated by nanostack/generator; DO NOT EDIT.
+// Generator inputs: sha256:85a337bfbe8a59dd38f7a94a56f7ef55e663e5431b2f515e6b609a29c1ff1c63
+
+package model
+
+type TeamBuilder struct {
+	instance *Team
+}
+
+func NewTeamBuilder() *TeamBuilder {
+	return &TeamBuilder{instance: &Team{}}
+}
+func (p *Team) ToBuilder() *TeamBuilder {
+	if p == nil {
+		return NewTeamBuilder()
+	}
+	return &TeamBuilder{instance: &Team{Name: p.Name, Lead: p.Lead}}
+}
+func (b *TeamBuilder) SetName(name string) *TeamBuilder {
+	b.instance.Name = name
+	return b
+}
+func (b *TeamBuilder) SetLead(lead *Person) *TeamBuilder {
+	b.instance.Lead = lead
+	return b
+}
+func (b *TeamBuilder) Build() *Team {
+	return b.instance
+}
+func (b *TeamBuilder) BuildAsPtr() *Team {
+	return b.instance
+}
@@ -0,0 +1,318 @@
+// Package stalebuilder defines an Analyzer reporting builders that no
+// longer match the structs they are generated for, so editors show the
+// problem before the build breaks or silently misses a field.
+package stalebuilder
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+	"github.com/nanostack-dev/generators/internal/cli"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const doc = `report builders that are out of date with their @builder struct
+
+For every struct annotated @builder, stalebuilder reports:
+  - fields without a setter in the generated builder,
+  - generated builder methods referring to fields removed from the struct,
+  - a builder file missing, or recording an input hash other than the one
+    the struct, its annotations, generators.json and the flags recorded
+    in the builder file now give.
+
+Run go generate, or the generator, to bring the builders up to date.`
+
+// Analyzer reports stale builders.
+var Analyzer = &analysis.Analyzer{
+	Name: "stalebuilder",
+	Doc:  doc,
+	Run:  run,
+	// Removed fields break the generated builder, so the package does not
+	// type check; editors still show why
+	RunDespiteErrors: true,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	var structDefs []*genparser.StructDef
+	generated := make(map[string]*ast.File)
+	dir := ""
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Package).Filename
+		dir = filepath.Dir(filename)
+		if isGenerated(pass, filename) {
+			generated[filename] = file
+			continue
+		}
+		// The generator leaves test files out
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		structDefs = append(structDefs, genparser.ParseStructs(pass.Fset, file)...)
+	}
+	genparser.ShareSiblings(structDefs)
+
+	var builders []*genparser.StructDef
+	for _, structDef := range structDefs {
+		if structDef.Annotations.Builder && !structDef.Annotations.Skip {
+			builders = append(builders, structDef)
+		}
+	}
+	if len(builders) == 0 {
+		return nil, nil
+	}
+
+	resolved, planned := plan(pass, dir, builders, generated)
+
+	reported := make(map[string]bool)
+	for _, structDef := range resolved {
+		// Builders generated into another package are out of reach
+		if structDef.Annotations.Package != "" && structDef.Annotations.Package != pass.Pkg.Name() {
+			continue
+		}
+		if checkSetters(pass, structDef) {
+			reported[structDef.Name] = true
+		}
+	}
+	for _, file := range generated {
+		for _, name := range checkRemovedFields(pass, file, builders) {
+			reported[name] = true
+		}
+	}
+
+	for _, file := range planned {
+		if file.Generator != "builder" || filepath.Dir(file.Path) != dir {
+			continue
+		}
+		checkHash(pass, file, reported)
+	}
+	return nil, nil
+}
+
+// plan returns builders with the settings they were generated with applied,
+// and the files planned for them. A builder file records the flags it was
+// generated with, so the structs of the files recording flags are planned
+// with them, and the others with the configuration file alone.
+func plan(pass *analysis.Pass, dir string, builders []*genparser.StructDef, generated map[string]*ast.File) ([]*genparser.StructDef, []cli.PlannedFile) {
+	recorded := make(map[string][]string)
+	for filename := range generated {
+		content, err := pass.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		if flags, ok := generator.RecordedFlags(content); ok {
+			recorded[strings.Join(flags, " ")] = flags
+		}
+	}
+
+	byName := make(map[string]*genparser.StructDef)
+	var planned []cli.PlannedFile
+	for _, key := range slices.Sorted(maps.Keys(recorded)) {
+		flags := recorded[key]
+		// Planning applies the settings to the structs, so each set of
+		// flags is planned on copies
+		copies := make([]*genparser.StructDef, len(builders))
+		for i, structDef := range builders {
+			structCopy := *structDef
+			structCopy.Fields = slices.Clone(structDef.Fields)
+			copies[i] = &structCopy
+		}
+		// Settings errors are for the generator to report
+		files, _ := cli.Plan(dir, copies, flags)
+		for _, file := range files {
+			if file.Generator != "builder" || !recordsFlags(pass, file.Path, flags) {
+				continue
+			}
+			planned = append(planned, file)
+			for _, structDef := range file.Types {
+				byName[structDef.Name] = structDef
+			}
+		}
+	}
+
+	var rest []*genparser.StructDef
+	for _, structDef := range builders {
+		if byName[structDef.Name] == nil {
+			rest = append(rest, structDef)
+		}
+	}
+	if len(rest) > 0 {
+		files, _ := cli.Plan(dir, rest, nil)
+		planned = append(planned, files...)
+	}
+
+	resolved := make([]*genparser.StructDef, len(builders))
+	for i, structDef := range builders {
+		resolved[i] = structDef
+		if flagged := byName[structDef.Name]; flagged != nil {
+			resolved[i] = flagged
+		}
+	}
+	return resolved, planned
+}
+
+// recordsFlags reports whether the file at path was generated with flags.
+func recordsFlags(pass *analysis.Pass, path string, flags []string) bool {
+	content, err := pass.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	recorded, ok := generator.RecordedFlags(content)
+	return ok && slices.Equal(recorded, flags)
+}
+
+// checkSetters reports the fields of structDef without a setter in its
+// builder, and whether it reported any.
+func checkSetters(pass *analysis.Pass, structDef *genparser.StructDef) bool {
+	builderName := structDef.Name + "Builder"
+	builder, ok := pass.Pkg.Scope().Lookup(builderName).(*types.TypeName)
+	if !ok {
+		// Reported by checkHash as a missing builder
+		return false
+	}
+	strct, ok := pass.Pkg.Scope().Lookup(structDef.Name).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	underlying, ok := strct.Type().Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+
+	methods := types.NewMethodSet(types.NewPointer(builder.Type()))
+	found := false
+	for _, field := range structDef.Fields {
+		setter, ok := generator.SetterName(structDef, field)
+		if !ok || methods.Lookup(pass.Pkg, setter) != nil {
+			continue
+		}
+		found = true
+		pass.Reportf(fieldPos(underlying, field.Name, strct), "%s has no %s setter for field %s: run go generate",
+			builderName, setter, field.Name)
+	}
+	return found
+}
+
+// fieldPos returns the position of the field name of strct, declared as
+// obj, or the position of obj when not found.
+func fieldPos(strct *types.Struct, name string, obj types.Object) token.Pos {
+	for i := 0; i < strct.NumFields(); i++ {
+		if field := strct.Field(i); field.Name() == name {
+			return field.Pos()
+		}
+	}
+	return obj.Pos()
+}
+
+// checkRemovedFields reports the selectors of fields no longer declared by
+// their struct in the builder methods of the generated file, and returns
+// the names of the structs concerned.
+func checkRemovedFields(pass *analysis.Pass, file *ast.File, builders []*genparser.StructDef) []string {
+	byBuilder := make(map[string]*types.TypeName)
+	for _, structDef := range builders {
+		if obj, ok := pass.Pkg.Scope().Lookup(structDef.Name).(*types.TypeName); ok {
+			byBuilder[structDef.Name+"Builder"] = obj
+		}
+	}
+
+	var names []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		strct := byBuilder[receiverName(fn)]
+		if strct == nil {
+			// ToBuilder is declared on the struct itself
+			strct = byBuilder[receiverName(fn)+"Builder"]
+		}
+		if strct == nil {
+			continue
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || !isStruct(pass.TypesInfo.TypeOf(sel.X), strct) {
+				return true
+			}
+			if obj, _, _ := types.LookupFieldOrMethod(strct.Type(), true, pass.Pkg, sel.Sel.Name); obj != nil {
+				return true
+			}
+			pass.Reportf(sel.Sel.Pos(), "%s refers to field %s, no longer declared by %s: run go generate",
+				fn.Name.Name, sel.Sel.Name, strct.Name())
+			if len(names) == 0 || names[len(names)-1] != strct.Name() {
+				names = append(names, strct.Name())
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// checkHash reports the structs of the planned builder file when the file
+// is missing or records another input hash, unless their problems were
+// already reported.
+func checkHash(pass *analysis.Pass, file cli.PlannedFile, reported map[string]bool) {
+	var problem string
+	content, err := pass.ReadFile(file.Path)
+	switch {
+	case err != nil:
+		problem = "has no generated builder"
+	default:
+		recorded, ok := generator.RecordedInputHash(content)
+		if ok && recorded == file.InputHash {
+			return
+		}
+		problem = fmt.Sprintf("has changed since %s was generated", filepath.Base(file.Path))
+	}
+
+	for _, structDef := range file.Types {
+		if reported[structDef.Name] {
+			continue
+		}
+		if obj := pass.Pkg.Scope().Lookup(structDef.Name); obj != nil {
+			pass.Reportf(obj.Pos(), "%s %s: run go generate", structDef.Name, problem)
+		}
+	}
+}
+
+// isGenerated reports whether the file named filename was written by the
+// generators, as the generator itself tells.
+func isGenerated(pass *analysis.Pass, filename string) bool {
+	content, err := pass.ReadFile(filename)
+	return err == nil && generator.IsGenerated(content)
+}
+
+// receiverName returns the name of the type fn is a method of, empty for
+// functions.
+func receiverName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// isStruct reports whether t is the struct declared as obj, or a pointer
+// to it.
+func isStruct(t types.Type, obj *types.TypeName) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj() == obj
+}
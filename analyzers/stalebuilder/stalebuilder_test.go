@@ -0,0 +1,150 @@
+package stalebuilder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/cli"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// generated is the source the builders are generated from.
+const generated = `package model
+
+// @builder
+type Person struct {
+	Name string
+	Age  int
+}
+
+// @builder
+type Team struct {
+	Name string
+}
+
+// Plain has no builder.
+type Plain struct{}
+`
+
+// edited is the source once edited: Age is replaced by Email, Team gets a
+// default the generated constructor lacks, and Pet asks for a builder.
+const edited = `package model
+
+// @builder
+type Person struct {
+	Name  string
+	Email string // want "PersonBuilder has no WithEmail setter for field Email: run go generate"
+}
+
+// @builder
+type Team struct { // want "Team has changed since team_builder.go was generated: run go generate"
+	Name string ` + "`default:\"core\"`" + `
+}
+
+// @builder
+type Pet struct { // want "Pet has no generated builder: run go generate"
+	Name string
+}
+
+// Plain has no builder.
+type Plain struct{}
+`
+
+func TestAnalyzer(t *testing.T) {
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "src", "model")
+	source := filepath.Join(modelDir, "model.go")
+	if err := os.MkdirAll(modelDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte(generated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.RunGenerator([]string{"-file", source}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// Up to date builders are not reported
+	analysistest.Run(t, dir, Analyzer, "model")
+
+	if err := os.WriteFile(source, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The generated setter and ToBuilder still refer to the removed field
+	builderFile := filepath.Join(modelDir, "person_builder.go")
+	content, err := os.ReadFile(builderFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ` // want "%s refers to field Age, no longer declared by Person: run go generate"`
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.Contains(line, "b.instance.Age ="):
+			line += strings.Replace(want, "%s", "WithAge", 1)
+		case strings.Contains(line, "p.Age"):
+			line += strings.Replace(want, "%s", "ToBuilder", 1)
+		}
+		lines = append(lines, line)
+	}
+	if err := os.WriteFile(builderFile, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	analysistest.Run(t, dir, Analyzer, "model")
+}
+
+// withFlags is the source of builders generated with go:generate flags:
+// Person is generated with -prefix Set, Team without flags.
+const withFlags = `package model
+
+// @builder
+type Person struct {
+	Name string
+}
+
+// @builder
+type Team struct {
+	Name string
+}
+`
+
+func TestAnalyzerFlags(t *testing.T) {
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "src", "model")
+	source := filepath.Join(modelDir, "model.go")
+	header := filepath.Join(modelDir, "header.tmpl")
+	if err := os.MkdirAll(modelDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte(withFlags), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(header, []byte("Built for {{.Types}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-file", source},
+		{"-file", source, "-type", "Person", "-prefix", "Set", "-header-file", header},
+	} {
+		if err := cli.RunGenerator(args, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Builders are checked with the flags they were generated with
+	analysistest.Run(t, dir, Analyzer, "model")
+
+	edited := strings.Replace(withFlags, "Name string\n}\n\n// @builder\ntype Team",
+		"Name  string\n\tEmail string // want \"PersonBuilder has no SetEmail setter for field Email: run go generate\"\n}\n\n// @builder\ntype Team", 1)
+	edited = strings.Replace(edited, "type Team struct {\n\tName string",
+		"type Team struct { // want \"Team has changed since team_builder.go was generated: run go generate\"\n\tName string `default:\"core\"`", 1)
+	if err := os.WriteFile(source, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	analysistest.Run(t, dir, Analyzer, "model")
+}
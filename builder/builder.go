@@ -0,0 +1,276 @@
+// Package builder generates builders, functional options and the other
+// companion code of annotated structs, as the generator commands do, for
+// tools embedding the generators. Sources are read from an fs.FS and the
+// generated files are returned in memory, leaving it to the caller to write
+// them:
+//
+//	files, diags, err := builder.Generate(ctx, builder.Request{
+//		FS:   os.DirFS("."),
+//		Dirs: []string{"internal/..."},
+//	})
+//
+// Generated files are identical to those of the commands run with the same
+// settings, so either can check the output of the other.
+package builder
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+	"github.com/nanostack-dev/generators/internal/builder/planner"
+)
+
+// Generation modes of Options.Mode for structs annotated with @builder.
+const (
+	ModeBuilder = planner.ModeBuilder
+	ModeOptions = planner.ModeOptions
+)
+
+// Options are the settings of every struct generated for a request, as set
+// by a generators.json configuration file. Struct annotations override
+// them, and zero values leave the defaults in place.
+type Options struct {
+	// Prefix of builder setters, With by default
+	Prefix string
+	// Output is the builder file pattern, {name}_builder.go by default.
+	// Without {name}, the builders of a package share one file.
+	Output string
+	// Package overrides the package of generated files
+	Package string
+	// Validate generates validation methods
+	Validate bool
+	// Mode is what to generate for @builder structs, ModeBuilder by default
+	Mode string
+	// Header is a text/template rendered as a comment below the header of
+	// generated files, with the fields of the commands' header files
+	Header string
+	// BuildConstraint is the //go:build expression of generated files,
+	// which otherwise get the constraint of their source file
+	BuildConstraint string
+	// Templates holds extension templates adding or replacing generated
+	// methods, as .tmpl files in a directory per generator such as
+	// builder/must_build.tmpl
+	Templates fs.FS
+}
+
+// Request describes what to generate.
+type Request struct {
+	// FS holds the Go sources
+	FS fs.FS
+	// Dirs lists the package directories of FS to generate for, as slash
+	// separated paths, "." when empty. A directory ending in /... also
+	// selects the packages below it, as go build patterns do.
+	Dirs []string
+	// Tags are the build tags honoured, with the GOOS and GOARCH of the
+	// running program, when selecting the files of a package
+	Tags []string
+	// Generators restricts generation to the named generators, as returned
+	// by Generators, all when nil
+	Generators []string
+	Options    Options
+}
+
+// File is a generated file.
+type File struct {
+	// Path is the slash separated path of the file in Request.FS
+	Path string
+	// Generator is the generator that produced the file, such as builder
+	Generator string
+	// Types are the structs the file is generated for, none for the files
+	// shared by the structs of a package
+	Types   []string
+	Content []byte
+}
+
+// Diagnostic reports a struct that could not be generated.
+type Diagnostic struct {
+	// Position is the declaration of the struct in Request.FS
+	Position  token.Position
+	Type      string
+	Generator string
+	Message   string
+}
+
+// String formats d like a compiler error.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: generating %s for %s: %s", d.Position, d.Generator, d.Type, d.Message)
+}
+
+// Generators returns the names of the generators: builder, options, merge,
+// patch, equal and clone.
+func Generators() []string {
+	return generator.GeneratorNames()
+}
+
+// Generate generates for the annotated structs of the requested packages
+// and returns the files in the order their structs are declared. Structs
+// failing to generate are reported as diagnostics while the others are
+// still generated. The error is set when the request is invalid, a package
+// cannot be read or parsed, or ctx is done.
+func Generate(ctx context.Context, req Request) ([]File, []Diagnostic, error) {
+	g, err := newGeneration(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs, err := packageDirs(req.FS, req.Dirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		structDefs, err := parseDir(req.FS, fset, dir, req.Tags)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, structDef := range structDefs {
+			// Failures are reported as diagnostics by the planner
+			_, _ = g.planner.PlanStruct(structDef, dir, g.settingsFor(structDef), "")
+		}
+	}
+
+	var files []File
+	for _, file := range g.planner.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		content, err := file.Render()
+		if err != nil {
+			g.fail(file.StructDefs[0], file.What, err)
+			continue
+		}
+		if content == nil {
+			continue
+		}
+		files = append(files, File{
+			Path:      file.Path,
+			Generator: file.Generator,
+			Types:     file.Types(),
+			Content:   content,
+		})
+	}
+	return files, g.diagnostics, nil
+}
+
+// generation plans and renders the files of a request.
+type generation struct {
+	req Request
+	// settings are those of every struct, before its annotations apply
+	settings    planner.Settings
+	planner     planner.Planner
+	diagnostics []Diagnostic
+}
+
+// newGeneration validates req and prepares its options.
+func newGeneration(req Request) (*generation, error) {
+	if req.FS == nil {
+		return nil, fmt.Errorf("request has no FS")
+	}
+	for _, name := range req.Generators {
+		if !slices.Contains(Generators(), name) {
+			return nil, fmt.Errorf("unknown generator %q: expected %s", name, strings.Join(Generators(), ", "))
+		}
+	}
+
+	options := req.Options
+	if options.Prefix == "" {
+		options.Prefix = parser.DefaultPrefix
+	}
+	if options.Output == "" {
+		options.Output = "{name}_builder.go"
+	}
+	if options.Mode == "" {
+		options.Mode = ModeBuilder
+	}
+	if options.Mode != ModeBuilder && options.Mode != ModeOptions {
+		return nil, fmt.Errorf("unknown mode %q: expected %s or %s", options.Mode, ModeBuilder, ModeOptions)
+	}
+
+	pre, err := planner.NewPreamble("header", options.Header, options.BuildConstraint)
+	if err != nil {
+		return nil, err
+	}
+	g := &generation{
+		req: req,
+		settings: planner.Settings{
+			Prefix:   options.Prefix,
+			Output:   options.Output,
+			Package:  options.Package,
+			Validate: options.Validate,
+			Mode:     options.Mode,
+			Preamble: pre,
+		},
+	}
+	if options.Templates != nil {
+		g.settings.Extensions = make(map[string]planner.Extensions)
+		for _, name := range Generators() {
+			extensions, err := planner.ReadExtensions(options.Templates, name, "")
+			if err != nil {
+				return nil, err
+			}
+			g.settings.Extensions[name] = extensions
+		}
+	}
+	g.planner = planner.Planner{
+		Path:     outputPath,
+		Selected: g.selected,
+		Fail: func(structDef *parser.StructDef, what string, err error) error {
+			g.fail(structDef, what, err)
+			return nil
+		},
+	}
+	return g, nil
+}
+
+// selected reports whether the generator name runs.
+func (g *generation) selected(name string) bool {
+	return g.req.Generators == nil || slices.Contains(g.req.Generators, name)
+}
+
+// fail reports that generating what for structDef failed with err.
+func (g *generation) fail(structDef *parser.StructDef, what string, err error) {
+	g.diagnostics = append(g.diagnostics, Diagnostic{
+		Position:  structDef.Position,
+		Type:      structDef.Name,
+		Generator: planner.GeneratorName(what),
+		Message:   err.Error(),
+	})
+}
+
+// settingsFor returns the settings of structDef: the options, overridden
+// by its annotations as they override a configuration file.
+func (g *generation) settingsFor(structDef *parser.StructDef) planner.Settings {
+	s := g.settings
+	annotations := structDef.Annotations
+	if annotations.Prefix != "" {
+		s.Prefix = annotations.Prefix
+	}
+	if annotations.Output != "" {
+		s.Output = annotations.Output
+	}
+	if annotations.Package != "" {
+		s.Package = annotations.Package
+	}
+	s.Validate = s.Validate || annotations.Validate
+	return s
+}
+
+// outputPath returns the slash separated path of the output file name of a
+// struct declared in dir, which must stay within the FS.
+func outputPath(dir string, name string) (string, error) {
+	p := path.Join(dir, name)
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("output %s is outside of the FS", p)
+	}
+	return p, nil
+}
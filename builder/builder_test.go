@@ -0,0 +1,252 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nanostack-dev/generators/internal/cli"
+)
+
+func TestGenerate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                    {Data: []byte("module example.com/app\n\ngo 1.24\n")},
+		"model/person.go":           {Data: []byte("package model\n\n// @builder\n// @equal\ntype Person struct{ Name string }\n")},
+		"model/team_integration.go": {Data: []byte("//go:build integration\n\npackage model\n\n// @builder\ntype Team struct{ Name string }\n")},
+		"model/person_test.go":      {Data: []byte("package model\n\n// @builder\ntype fixture struct{ Name string }\n")},
+		"model/testdata/draft.go":   {Data: []byte("package draft\n\n// @builder\ntype Draft struct{ Name string }\n")},
+		"tools/go.mod":              {Data: []byte("module example.com/tools\n\ngo 1.24\n")},
+		"tools/tool.go":             {Data: []byte("package tools\n\n// @builder\ntype Tool struct{ Name string }\n")},
+	}
+
+	files, diags, err := Generate(context.Background(), Request{
+		FS:      fsys,
+		Dirs:    []string{"./..."},
+		Options: Options{Prefix: "Set"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	want := []string{"model/person_builder.go", "model/person_equal.go", "model/field_change.go"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Fatalf("generated %v, want %v", paths, want)
+	}
+	if files[0].Generator != "builder" || strings.Join(files[0].Types, ",") != "Person" {
+		t.Errorf("builder file is %+v", files[0])
+	}
+	if !strings.Contains(string(files[0].Content), "func (b *PersonBuilder) SetName(name string) *PersonBuilder") {
+		t.Errorf("builder does not use the prefix option:\n%s", files[0].Content)
+	}
+	if files[2].Generator != "equal" || files[2].Types != nil {
+		t.Errorf("support file is %+v", files[2])
+	}
+
+	// Build tags select files like go build does
+	files, _, err = Generate(context.Background(), Request{
+		FS:         fsys,
+		Dirs:       []string{"model"},
+		Tags:       []string{"integration"},
+		Generators: []string{"builder"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1].Path != "model/team_builder.go" {
+		t.Fatalf("expected the builders of Person and Team, got %v", files)
+	}
+	if !strings.Contains(string(files[1].Content), "//go:build integration\n") {
+		t.Errorf("builder does not keep the constraint of its source:\n%s", files[1].Content)
+	}
+}
+
+func TestGenerateAnnotationPrefix(t *testing.T) {
+	fsys := fstest.MapFS{
+		"model/person.go": {Data: []byte("package model\n\n// @builder\n// @builder:prefix With\ntype Person struct{ Name string }\n")},
+	}
+
+	// An annotation naming the default prefix overrides the options too
+	files, _, err := Generate(context.Background(), Request{FS: fsys, Dirs: []string{"model"}, Options: Options{Prefix: "Set"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.Contains(string(files[0].Content), "func (b *PersonBuilder) WithName(name string) *PersonBuilder") {
+		t.Errorf("builder does not use the annotation prefix: %v", files)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	fsys := fstest.MapFS{
+		"model/person.go": {Data: []byte("package model\n\n// @builder\n// @clone\ntype Person struct{ Tags []string }\n")},
+	}
+	files, _, err := Generate(context.Background(), Request{FS: fsys, Dirs: []string{"model"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sink MemorySink
+	if err := Write(&sink, files); err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(sink.Names(), " "); names != "model/person_builder.go model/person_clone.go" {
+		t.Errorf("wrote %s", names)
+	}
+
+	// The sink serves as an overlay of the sources, which the generated
+	// files leave alone when generating again
+	generated := sink.FS()
+	overlay := fstest.MapFS{}
+	err = fs.WalkDir(generated, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(generated, name)
+		overlay[name] = &fstest.MapFile{Data: content}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, file := range fsys {
+		overlay[name] = file
+	}
+	again, _, err := Generate(context.Background(), Request{FS: overlay, Dirs: []string{"model"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, file := range again {
+		if !bytes.Equal(file.Content, files[i].Content) {
+			t.Errorf("%s changed once generated files are present", file.Path)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "model"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(DirSink{Dir: dir}, files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model", "person_clone.go")); err != nil {
+		t.Errorf("DirSink did not write the clone methods: %v", err)
+	}
+}
+
+func TestGenerateDiagnostics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"model/model.go": {Data: []byte(`package model
+
+// @builder
+type Person struct{ Name string }
+
+// @builder
+// @builder:package fixtures
+type Team struct{ Name string }
+`)},
+	}
+
+	files, diags, err := Generate(context.Background(), Request{
+		FS:      fsys,
+		Dirs:    []string{"model"},
+		Options: Options{Output: "zz_builders.go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || strings.Join(files[0].Types, ",") != "Person" {
+		t.Errorf("expected the builder of Person alone, got %v", files)
+	}
+	if len(diags) != 1 {
+		t.Fatalf("expected one diagnostic, got %v", diags)
+	}
+	want := "model/model.go:8:6: generating builder for Team: model/zz_builders.go is generated in package model for Person, not fixtures"
+	if diags[0].String() != want {
+		t.Errorf("diagnostic is %q, want %q", diags[0], want)
+	}
+
+	for name, req := range map[string]Request{
+		"no FS":             {},
+		"unknown generator": {FS: fsys, Generators: []string{"mock"}},
+		"unknown mode":      {FS: fsys, Options: Options{Mode: "fluent"}},
+		"bad constraint":    {FS: fsys, Options: Options{BuildConstraint: "linux &&"}},
+		"missing directory": {FS: fsys, Dirs: []string{"api"}},
+	} {
+		if _, _, err := Generate(context.Background(), req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := Generate(ctx, Request{FS: fsys, Dirs: []string{"model"}}); err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestGenerateMatchesCommand(t *testing.T) {
+	const header = "Copyright 2026 Acme.\n\n{{.Generator}} for {{.Types}}.\n"
+	const mustBuild = `
+// MustBuild returns the {{.Struct.Name}}.
+func (b *{{.Struct.Name}}Builder) MustBuild() *{{.Struct.Name}} {
+	return b.Build()
+}
+`
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":                            "module example.com/app\n\ngo 1.24\n",
+		"generators.json":                   `{"prefix": "Set", "headerFile": "header.tmpl", "templates": "templates"}`,
+		"header.tmpl":                       header,
+		"templates/builder/must_build.tmpl": mustBuild,
+		"model/model.go":                    "package model\n\nimport \"time\"\n\n// @builder\n// @equal\n// @clone\ntype Event struct {\n\tTitle string\n\tStart time.Time\n}\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, diags, err := Generate(context.Background(), Request{
+		FS:   os.DirFS(dir),
+		Dirs: []string{"model"},
+		Options: Options{
+			Prefix:    "Set",
+			Header:    header,
+			Templates: os.DirFS(filepath.Join(dir, "templates")),
+		},
+	})
+	if err != nil || len(diags) > 0 {
+		t.Fatalf("Generate() = %v, %v", diags, err)
+	}
+	if err := cli.RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 4 {
+		t.Fatalf("expected four files, got %d", len(files))
+	}
+	for _, file := range files {
+		written, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(file.Content, written) {
+			t.Errorf("%s differs from the file the generator writes:\n%s\nwant:\n%s", file.Path, file.Content, written)
+		}
+	}
+}
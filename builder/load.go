@@ -0,0 +1,123 @@
+package builder
+
+import (
+	"fmt"
+	"go/build"
+	goparser "go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+// packageDirs expands patterns into the directories of fsys holding Go
+// files. A pattern ending in /... selects its directory and those below it,
+// leaving out testdata and vendor directories, directories starting with .
+// or _ and nested modules, as the go command does.
+func packageDirs(fsys fs.FS, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pattern := range patterns {
+		root, recursive := strings.CutSuffix(pattern, "...")
+		root = path.Clean(strings.TrimPrefix(root, "./"))
+		if !fs.ValidPath(root) {
+			return nil, fmt.Errorf("invalid directory %q", pattern)
+		}
+		if !recursive {
+			add(root)
+			continue
+		}
+
+		err := fs.WalkDir(fsys, root, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				return nil
+			}
+			if p != root {
+				name := entry.Name()
+				if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return fs.SkipDir
+				}
+				if _, err := fs.Stat(fsys, path.Join(p, "go.mod")); err == nil {
+					return fs.SkipDir
+				}
+			}
+			if hasGoFiles(fsys, p) {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// hasGoFiles reports whether dir holds Go files.
+func hasGoFiles(fsys fs.FS, dir string) bool {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*.go"))
+	return err == nil && len(matches) > 0
+}
+
+// parseDir returns the structs declared in the package in dir. Files are
+// selected like go build does with tags, and test and generated files are
+// left out.
+func parseDir(fsys fs.FS, fset *token.FileSet, dir string, tags []string) ([]*parser.StructDef, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxt := build.Default
+	ctxt.BuildTags = tags
+	ctxt.JoinPath = path.Join
+	ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}
+
+	var structDefs []*parser.StructDef
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := ctxt.MatchFile(dir, name); err != nil {
+			return nil, err
+		} else if !match {
+			continue
+		}
+
+		filePath := path.Join(dir, name)
+		src, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return nil, err
+		}
+		if generator.IsGenerated(src) {
+			continue
+		}
+		file, err := goparser.ParseFile(fset, filePath, src, goparser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		structDefs = append(structDefs, parser.ParseStructs(fset, file)...)
+	}
+	parser.ShareSiblings(structDefs)
+	return structDefs, nil
+}
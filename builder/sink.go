@@ -0,0 +1,28 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+)
+
+// Sink receives the files written by Write.
+type Sink = generator.Sink
+
+// DirSink writes files to disk, with names relative to its Dir field.
+type DirSink = generator.DirSink
+
+// MemorySink keeps files in memory, readable by name or as an fs.FS
+// overlay, without touching the working tree. Its zero value is empty.
+type MemorySink = generator.MemorySink
+
+// Write writes files to sink at their paths, stopping at the first
+// failure.
+func Write(sink Sink, files []File) error {
+	for _, file := range files {
+		if err := sink.WriteFile(file.Path, file.Content); err != nil {
+			return fmt.Errorf("writing %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// Command buildervet runs the analyzers of the builder generator, on its
+// own or as go vet -vettool=$(which buildervet).
+package main
+
+import (
+	"github.com/nanostack-dev/generators/analyzers/enforcebuilder"
+	"github.com/nanostack-dev/generators/analyzers/stalebuilder"
+
+	"golang.org/x/tools/go/analysis/multichecker"
+)
+
+func main() {
+	multichecker.Main(stalebuilder.Analyzer, enforcebuilder.Analyzer)
+}
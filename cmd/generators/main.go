@@ -0,0 +1,14 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/nanostack-dev/generators/internal/cli"
+)
+
+func main() {
+	if err := cli.Run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
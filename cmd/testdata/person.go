@@ -0,0 +1,8 @@
+package testmodel
+
+// Person has no @builder annotation: the integration test selects it with
+// -type instead.
+type Person struct {
+	Name string
+	Age  int
+}
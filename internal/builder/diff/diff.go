@@ -0,0 +1,217 @@
+// Package diff renders line-based differences between two versions of a
+// file in the unified format understood by patch and code review tools.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// maxCost bounds the edits searched for from each end of a range before
+// the whole range is replaced instead, keeping rewritten files fast.
+const maxCost = 1024
+
+// edit is one line of the edit script turning a into b: kept (' '),
+// removed from a ('-') or added from b ('+').
+type edit struct {
+	kind byte
+	line string
+}
+
+// Unified returns the unified diff turning from into to, labelled with
+// fromName and toName, or an empty string when both are identical.
+func Unified(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+
+	edits := diffLines(splitLines(from), splitLines(to))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// aPos and bPos hold the line of a and b each edit starts at
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.kind != '+' {
+			aPos[i+1]++
+		}
+		if e.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Grow the hunk while the next change is close enough for the
+		// context of both to overlap
+		start := max(0, i-context)
+		end := i + 1
+		for j := end; j < len(edits) && j < end+2*context; j++ {
+			if edits[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(len(edits), end+context)
+
+		aCount, bCount := aPos[end]-aPos[start], bPos[end]-bPos[start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aCount), hunkRange(bPos[start], bCount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the start,count pair of a hunk header. Lines are
+// numbered from one; an empty range refers to the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits content after each newline, keeping the newlines.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script turning a into b, found by the
+// linear space variant of the Myers algorithm.
+func diffLines(a, b []string) []edit {
+	return appendEdits(nil, a, b)
+}
+
+// appendEdits appends the edits turning a into b to edits. Once the common
+// prefix and suffix are set aside, the middle snake of a shortest edit
+// script splits what remains into two smaller problems.
+func appendEdits(edits []edit, a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(midA) == 0:
+		for _, line := range midB {
+			edits = append(edits, edit{'+', line})
+		}
+	case len(midB) == 0:
+		for _, line := range midA {
+			edits = append(edits, edit{'-', line})
+		}
+	default:
+		x, y, u, v, ok := middleSnake(midA, midB)
+		if !ok {
+			for _, line := range midA {
+				edits = append(edits, edit{'-', line})
+			}
+			for _, line := range midB {
+				edits = append(edits, edit{'+', line})
+			}
+			break
+		}
+		edits = appendEdits(edits, midA[:x], midB[:y])
+		for _, line := range midA[x:u] {
+			edits = append(edits, edit{' ', line})
+		}
+		edits = appendEdits(edits, midA[u:], midB[v:])
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// middleSnake returns the middle snake of a shortest edit script turning a
+// into b, from (x, y) to (u, v), by searching from both ends at once until
+// the paths overlap. It returns false when the script is longer than twice
+// maxCost. a and b must be non-empty.
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := min((n+m+1)/2, maxCost)
+	offset := limit + 1
+
+	// forward[k+offset] is the furthest x reached on diagonal k = x - y from
+	// the start; backward[k+offset] the furthest number of lines of a left
+	// behind on diagonal k of the reversed sequences
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[k-1+offset] < forward[k+1+offset]) {
+				x = forward[k+1+offset]
+			} else {
+				x = forward[k-1+offset] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[k+offset] = u
+			if r := delta - k; odd && r >= -(d-1) && r <= d-1 && u+backward[r+offset] >= n {
+				return x, y, u, v, true
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var xr int
+			if k == -d || (k != d && backward[k-1+offset] < backward[k+1+offset]) {
+				xr = backward[k+1+offset]
+			} else {
+				xr = backward[k-1+offset] + 1
+			}
+			yr := xr - k
+			ur, vr := xr, yr
+			for ur < n && vr < m && a[n-1-ur] == b[m-1-vr] {
+				ur++
+				vr++
+			}
+			backward[k+offset] = ur
+			if f := delta - k; !odd && f >= -d && f <= d && ur+forward[f+offset] >= n {
+				return n - ur, m - vr, n - xr, m - yr, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
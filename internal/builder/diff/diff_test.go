@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "identical",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line with context",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "missing file",
+			from: "",
+			to:   "package model\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+package model\n",
+		},
+		{
+			name: "missing trailing newline",
+			from: "a\nb",
+			to:   "a\nc\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", []byte(tt.from), []byte(tt.to))
+			if got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+
+	for range 2000 {
+		a, b := randomLines(), randomLines()
+		edits := diffLines(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.kind != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.kind != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.kind != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits of %q to %q do not rebuild them: %v", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changes != want {
+			t.Fatalf("edits of %q to %q change %d lines, want %d", a, b, changes, want)
+		}
+	}
+}
+
+func TestUnifiedLargeFile(t *testing.T) {
+	// A table of every pair of lines would take gigabytes
+	var from, to strings.Builder
+	for i := range 50000 {
+		fmt.Fprintf(&from, "line %d\n", i)
+		if i%1000 == 0 {
+			fmt.Fprintf(&to, "changed %d\n", i)
+			continue
+		}
+		fmt.Fprintf(&to, "line %d\n", i)
+	}
+
+	out := Unified("old", "new", []byte(from.String()), []byte(to.String()))
+	if got := strings.Count(out, "\n-line "); got != 50 {
+		t.Errorf("removed %d lines, want 50", got)
+	}
+
+	// A rewritten file is replaced as a whole
+	rewritten := strings.ReplaceAll(from.String(), "line", "row")
+	out = Unified("old", "new", []byte(from.String()), []byte(rewritten))
+	if !strings.HasPrefix(out, "--- old\n+++ new\n@@ -1,50000 +1,50000 @@\n-line 0\n") {
+		t.Errorf("rewritten file is not replaced as a whole:\n%.200s", out)
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return lcs[0][0]
+}
@@ -0,0 +1,274 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GenerateClone writes Clone and DeepCopyInto methods for structDef to
+// outputFile, in the style of Kubernetes deepcopy-gen. Slices, maps, arrays
+// and pointers are copied recursively, structs annotated with @clone in the
+// same package through their generated methods, and interface values and
+// other named types through a Clone method on their dynamic type, or on a
+// pointer to it, when it has one, by value otherwise. The struct graph must be free of cycles.
+func GenerateClone(structDef *parser.StructDef, packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderClone(w, structDef, packageName)
+	})
+}
+
+// RenderClone writes the source GenerateClone saves to w.
+func RenderClone(w io.Writer, structDef *parser.StructDef, packageName string) error {
+	if structDef == nil {
+		return fmt.Errorf("structDef cannot be nil")
+	}
+
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	f, importAliases := newFile(structDef, packageName)
+
+	g := &cloneGenerator{
+		structDef:     structDef,
+		importAliases: importAliases,
+	}
+
+	generateDeepCopyInto(f, g)
+	generateCloneMethod(f, structDef.Name)
+	g.helpers.render(f)
+
+	return f.Render(w)
+}
+
+func generateDeepCopyInto(f *jen.File, g *cloneGenerator) {
+	body := []jen.Code{
+		jen.Op("*").Id("out").Op("=").Op("*").Id("p"),
+	}
+
+	fields := append(append([]parser.StructField{}, g.structDef.Embedded...), g.structDef.Fields...)
+	for _, field := range fields {
+		expr := parseType(field.Type)
+		if !g.needsCopy(expr) {
+			continue
+		}
+
+		// Nested @clone structs copy themselves in place
+		if ident, ok := expr.(*ast.Ident); ok && g.hasClone(ident.Name) {
+			body = append(body, jen.Id("p").Dot(field.Name).Dot("DeepCopyInto").Call(
+				jen.Op("&").Id("out").Dot(field.Name),
+			))
+			continue
+		}
+
+		body = append(body, jen.Id("out").Dot(field.Name).Op("=").Add(
+			g.copyOf(jen.Id("p").Dot(field.Name), expr, "clone"+g.structDef.Name+field.Name),
+		))
+	}
+
+	f.Func().Params(
+		jen.Id("p").Op("*").Id(g.structDef.Name),
+	).Id("DeepCopyInto").Params(
+		jen.Id("out").Op("*").Id(g.structDef.Name),
+	).Block(body...)
+}
+
+func generateCloneMethod(f *jen.File, structName string) {
+	f.Func().Params(
+		jen.Id("p").Op("*").Id(structName),
+	).Id("Clone").Params().Op("*").Id(structName).Block(
+		jen.If(jen.Id("p").Op("==").Nil()).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Id("out").Op(":=").New(jen.Id(structName)),
+		jen.Id("p").Dot("DeepCopyInto").Call(jen.Id("out")),
+		jen.Return(jen.Id("out")),
+	)
+}
+
+// cloneGenerator renders deep copies for one struct, emitting helper functions
+// for composite types.
+type cloneGenerator struct {
+	structDef     *parser.StructDef
+	importAliases map[string]string
+	helpers       helperSet
+}
+
+// hasClone reports whether the named type in the same package gets generated
+// Clone and DeepCopyInto methods.
+func (g *cloneGenerator) hasClone(name string) bool {
+	if name == g.structDef.Name {
+		return g.structDef.Annotations.Clone
+	}
+	return g.structDef.Siblings[name].Clone
+}
+
+// needsCopy reports whether a value of type expr shares memory with its
+// source after a plain assignment.
+func (g *cloneGenerator) needsCopy(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		// Named types may be interfaces, which only their Clone method copies
+		return t.Name == "any" || g.hasClone(t.Name) || types.Universe.Lookup(t.Name) == nil
+	case *ast.SelectorExpr:
+		return true
+	case *ast.InterfaceType:
+		return t.Methods == nil || len(t.Methods.List) == 0
+	case *ast.ArrayType:
+		return t.Len == nil || g.needsCopy(t.Elt)
+	case *ast.StarExpr, *ast.MapType:
+		return true
+	}
+	return false
+}
+
+// copyOf returns an expression evaluating to a deep copy of in, a value of
+// type expr. Composite types are copied by a helper function named helperName.
+func (g *cloneGenerator) copyOf(in *jen.Statement, expr ast.Expr, helperName string) *jen.Statement {
+	if !g.needsCopy(expr) {
+		return in
+	}
+
+	paramType := qualifiedType(expr, g.importAliases)
+
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case t.Name == "any":
+			g.addInterfaceHelper(helperName, paramType)
+		case g.hasClone(t.Name):
+			return jen.Op("*").Add(in).Dot("Clone").Call()
+		default:
+			g.addNamedHelper(helperName, paramType)
+		}
+	case *ast.SelectorExpr:
+		g.addNamedHelper(helperName, paramType)
+	case *ast.InterfaceType:
+		g.addInterfaceHelper(helperName, paramType)
+	case *ast.StarExpr:
+		if ident, ok := t.X.(*ast.Ident); ok && g.hasClone(ident.Name) {
+			return in.Dot("Clone").Call()
+		}
+		g.addHelper(helperName, paramType, []jen.Code{
+			jen.If(jen.Id("in").Op("==").Nil()).Block(
+				jen.Return(jen.Nil()),
+			),
+			jen.Id("out").Op(":=").New(qualifiedType(t.X, g.importAliases)),
+			jen.Op("*").Id("out").Op("=").Add(g.copyOf(jen.Op("*").Id("in"), t.X, helperName+"Elem")),
+			jen.Return(jen.Id("out")),
+		})
+	case *ast.ArrayType:
+		elem := jen.Id("out").Index(jen.Id("i")).Op("=").Add(
+			g.copyOf(jen.Id("in").Index(jen.Id("i")), t.Elt, helperName+"Elem"),
+		)
+		if t.Len != nil {
+			g.addHelper(helperName, paramType, []jen.Code{
+				jen.Id("out").Op(":=").Id("in"),
+				jen.For(jen.Id("i").Op(":=").Range().Id("in")).Block(elem),
+				jen.Return(jen.Id("out")),
+			})
+			break
+		}
+
+		copyElems := jen.Copy(jen.Id("out"), jen.Id("in"))
+		if g.needsCopy(t.Elt) {
+			copyElems = jen.For(jen.Id("i").Op(":=").Range().Id("in")).Block(elem)
+		}
+		g.addHelper(helperName, paramType, []jen.Code{
+			jen.If(jen.Id("in").Op("==").Nil()).Block(
+				jen.Return(jen.Nil()),
+			),
+			jen.Id("out").Op(":=").Make(paramType.Clone(), jen.Len(jen.Id("in"))),
+			copyElems,
+			jen.Return(jen.Id("out")),
+		})
+	case *ast.MapType:
+		g.addHelper(helperName, paramType, []jen.Code{
+			jen.If(jen.Id("in").Op("==").Nil()).Block(
+				jen.Return(jen.Nil()),
+			),
+			jen.Id("out").Op(":=").Make(paramType.Clone(), jen.Len(jen.Id("in"))),
+			jen.For(jen.List(jen.Id("k"), jen.Id("v")).Op(":=").Range().Id("in")).Block(
+				jen.Id("out").Index(jen.Id("k")).Op("=").Add(g.copyOf(jen.Id("v"), t.Value, helperName+"Value")),
+			),
+			jen.Return(jen.Id("out")),
+		})
+	}
+
+	return jen.Id(helperName).Call(in)
+}
+
+// addInterfaceHelper records a helper copying an interface value through the
+// Clone method of its dynamic type, falling back to the value itself.
+func (g *cloneGenerator) addInterfaceHelper(helperName string, paramType *jen.Statement) {
+	body := []jen.Code{
+		jen.If(jen.Id("in").Op("==").Nil()).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Id("v").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("in")),
+	}
+	body = append(body, cloneMethodCall(jen.Return(jen.Id("out").Dot("Interface").Call()))...)
+	g.addHelper(helperName, paramType, append(body, jen.Return(jen.Id("in"))))
+}
+
+// addNamedHelper records a helper copying a value of a named type, interface
+// or not, through the Clone method of its dynamic type when it returns the
+// same type, falling back to the value itself.
+func (g *cloneGenerator) addNamedHelper(helperName string, paramType *jen.Statement) {
+	body := []jen.Code{
+		jen.Id("v").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("in")),
+		jen.If(jen.Op("!").Id("v").Dot("IsValid").Call()).Block(
+			jen.Return(jen.Id("in")),
+		),
+	}
+	body = append(body, cloneMethodCall(jen.If(
+		jen.List(jen.Id("out"), jen.Id("ok")).Op(":=").Id("out").Dot("Interface").Call().Assert(paramType.Clone()),
+		jen.Id("ok"),
+	).Block(
+		jen.Return(jen.Id("out")),
+	))...)
+	g.addHelper(helperName, paramType, append(body, jen.Return(jen.Id("in"))))
+}
+
+// cloneMethodCall returns the statements calling the Clone method of v, the
+// reflect.Value of in, and running use with its result as out. Clone is
+// looked up on the type of v, then on a pointer to it, as generated for
+// @clone structs, whose *T result is dereferenced.
+func cloneMethodCall(use jen.Code) []jen.Code {
+	return []jen.Code{
+		jen.Id("clone").Op(":=").Id("v").Dot("MethodByName").Call(jen.Lit("Clone")),
+		jen.If(jen.Op("!").Id("clone").Dot("IsValid").Call()).Block(
+			jen.Id("ptr").Op(":=").Qual("reflect", "New").Call(jen.Id("v").Dot("Type").Call()),
+			jen.Id("ptr").Dot("Elem").Call().Dot("Set").Call(jen.Id("v")),
+			jen.Id("clone").Op("=").Id("ptr").Dot("MethodByName").Call(jen.Lit("Clone")),
+		),
+		jen.If(
+			jen.Id("clone").Dot("IsValid").Call().
+				Op("&&").Id("clone").Dot("Type").Call().Dot("NumIn").Call().Op("==").Lit(0).
+				Op("&&").Id("clone").Dot("Type").Call().Dot("NumOut").Call().Op("==").Lit(1),
+		).Block(
+			jen.Id("out").Op(":=").Id("clone").Dot("Call").Call(jen.Nil()).Index(jen.Lit(0)),
+			jen.If(
+				jen.Id("out").Dot("Kind").Call().Op("==").Qual("reflect", "Pointer").
+					Op("&&").Id("out").Dot("Type").Call().Dot("Elem").Call().Op("==").Id("v").Dot("Type").Call().
+					Op("&&").Op("!").Id("out").Dot("IsNil").Call(),
+			).Block(
+				jen.Id("out").Op("=").Id("out").Dot("Elem").Call(),
+			),
+			use,
+		),
+	}
+}
+
+// addHelper records func helperName(in T) T with the given body, once.
+func (g *cloneGenerator) addHelper(helperName string, paramType *jen.Statement, body []jen.Code) {
+	g.helpers.add(helperName, jen.Func().Id(helperName).Params(
+		jen.Id("in").Add(paramType.Clone()),
+	).Add(paramType.Clone()).Block(body...))
+}
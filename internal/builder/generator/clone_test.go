@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestGenerateClone(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "Doc",
+		PackageStr: "testmodel",
+		Fields: []parser.StructField{
+			{Name: "Title", Type: "string"},
+			{Name: "Tags", Type: "[]string"},
+			{Name: "Attrs", Type: "map[string]*Meta"},
+			{Name: "Parent", Type: "*Doc"},
+			{Name: "Payload", Type: "any"},
+			{Name: "When", Type: "*time.Time"},
+			{Name: "Plain", Type: "[3]int"},
+			{Name: "Shape", Type: "Shape"},
+			{Name: "Body", Type: "io.Reader"},
+		},
+		Embedded: []parser.StructField{
+			{Name: "Meta", Type: "Meta"},
+		},
+		Imports: []string{
+			`"io"`,
+			`"time"`,
+		},
+		Annotations: parser.BuilderAnnotations{
+			Clone: true,
+		},
+		Siblings: map[string]parser.BuilderAnnotations{
+			"Meta": {Clone: true},
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "doc_clone.go")
+
+	if err := GenerateClone(structDef, "testmodel", outputFile); err != nil {
+		t.Fatalf("GenerateClone failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	generated := string(content)
+	t.Logf("Generated code:\n%s", generated)
+
+	expected := []string{
+		"func (p *Doc) DeepCopyInto(out *Doc)",
+		"*out = *p",
+		"p.Meta.DeepCopyInto(&out.Meta)",
+		"out.Tags = cloneDocTags(p.Tags)",
+		"out.Attrs = cloneDocAttrs(p.Attrs)",
+		"out.Parent = p.Parent.Clone()",
+		"out.Payload = cloneDocPayload(p.Payload)",
+		"out.When = cloneDocWhen(p.When)",
+		"func (p *Doc) Clone() *Doc",
+		"func cloneDocTags(in []string) []string",
+		"copy(out, in)",
+		"out[k] = v.Clone()",
+		`clone := v.MethodByName("Clone")`,
+		"ptr := reflect.New(v.Type())",
+		"out = out.Elem()",
+		"func cloneDocWhen(in *time.Time) *time.Time",
+		"out.Shape = cloneDocShape(p.Shape)",
+		"out.Body = cloneDocBody(p.Body)",
+		"func cloneDocBody(in io.Reader) io.Reader",
+		`if out, ok := out.Interface().(io.Reader); ok {`,
+	}
+
+	for _, item := range expected {
+		if !strings.Contains(generated, item) {
+			t.Errorf("Generated code missing: %s", item)
+		}
+	}
+
+	for _, unexpected := range []string{"out.Title =", "out.Plain ="} {
+		if strings.Contains(generated, unexpected) {
+			t.Errorf("Generated code should copy %s by value", strings.TrimSuffix(unexpected, " ="))
+		}
+	}
+}
+
+func TestGenerateToBuilderUsesClone(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "Doc",
+		PackageStr: "testmodel",
+		Fields: []parser.StructField{
+			{Name: "Tags", Type: "[]string"},
+		},
+		Annotations: parser.BuilderAnnotations{
+			Clone: true,
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "doc_builder.go")
+
+	if err := Generate(structDef, "testmodel", outputFile); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if !strings.Contains(string(content), "return &DocBuilder{instance: p.Clone()}") {
+		t.Errorf("ToBuilder should deep copy through Clone:\n%s", content)
+	}
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"io"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+// Companion describes a generator triggered by its own struct marker and
+// writing next to the source file, alongside or instead of the builder.
+type Companion struct {
+	Marker        string
+	Enabled       func(annotations parser.BuilderAnnotations) bool
+	OutputPattern string
+	Render        func(w io.Writer, structDef *parser.StructDef, packageName string) error
+	// SupportFile, when set, is written once per directory by Support and
+	// holds declarations shared by every struct using the marker.
+	SupportFile string
+	Support     func(w io.Writer, packageName string) error
+}
+
+// Name returns the name selecting the companion, such as equal: its marker
+// without the @.
+func (c Companion) Name() string {
+	return strings.TrimPrefix(c.Marker, "@")
+}
+
+// Companions lists the generators other than the builder, in the order
+// their files are planned for a struct.
+var Companions = []Companion{
+	{
+		Marker:        "@options",
+		Enabled:       func(a parser.BuilderAnnotations) bool { return a.Options },
+		OutputPattern: "{name}_options.go",
+		Render:        RenderOptions,
+	},
+	{
+		Marker:        "@merge",
+		Enabled:       func(a parser.BuilderAnnotations) bool { return a.Merge },
+		OutputPattern: "{name}_merge.go",
+		Render:        RenderMerge,
+	},
+	{
+		Marker:        "@patch",
+		Enabled:       func(a parser.BuilderAnnotations) bool { return a.Patch },
+		OutputPattern: "{name}_patch.go",
+		Render:        RenderPatch,
+	},
+	{
+		Marker:        "@equal",
+		Enabled:       func(a parser.BuilderAnnotations) bool { return a.Equal },
+		OutputPattern: "{name}_equal.go",
+		Render:        RenderEqual,
+		SupportFile:   "field_change.go",
+		Support:       RenderFieldChange,
+	},
+	{
+		Marker:        "@clone",
+		Enabled:       func(a parser.BuilderAnnotations) bool { return a.Clone },
+		OutputPattern: "{name}_clone.go",
+		Render:        RenderClone,
+	},
+}
+
+// GeneratorNames returns the names of every generator: builder, then the
+// companions.
+func GeneratorNames() []string {
+	names := []string{"builder"}
+	for _, c := range Companions {
+		names = append(names, c.Name())
+	}
+	return names
+}
@@ -0,0 +1,260 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GenerateEqual writes Equal and Diff methods for structDef to outputFile.
+// Fields are compared without reflection where the type allows it: slices and
+// maps element by element (nil and empty are equal), pointers by the value
+// they point to, time.Time through its Equal method and structs annotated
+// with @equal through their generated Equal. Other named types fall back to
+// reflect.DeepEqual.
+//
+// Diff reports changes as []FieldChange; the type is written once per package
+// by GenerateFieldChange.
+func GenerateEqual(structDef *parser.StructDef, packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderEqual(w, structDef, packageName)
+	})
+}
+
+// RenderEqual writes the source GenerateEqual saves to w.
+func RenderEqual(w io.Writer, structDef *parser.StructDef, packageName string) error {
+	if structDef == nil {
+		return fmt.Errorf("structDef cannot be nil")
+	}
+
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	f, importAliases := newFile(structDef, packageName)
+
+	g := &equalGenerator{
+		structDef:     structDef,
+		importAliases: importAliases,
+	}
+
+	generateEqualMethod(f, g)
+	generateDiffMethod(f, g)
+	g.helpers.render(f)
+
+	return f.Render(w)
+}
+
+// GenerateFieldChange writes the FieldChange type returned by the generated
+// Diff methods. It is shared by every @equal struct of the package.
+func GenerateFieldChange(packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderFieldChange(w, packageName)
+	})
+}
+
+// RenderFieldChange writes the source GenerateFieldChange saves to w.
+func RenderFieldChange(w io.Writer, packageName string) error {
+	f := jen.NewFile(packageName)
+	f.HeaderComment(Header)
+
+	f.Comment("FieldChange describes a field whose value differs between two structs.")
+	f.Type().Id("FieldChange").Struct(
+		jen.Id("Path").String(),
+		jen.Id("Old").Any(),
+		jen.Id("New").Any(),
+	)
+
+	f.Func().Params(
+		jen.Id("c").Id("FieldChange"),
+	).Id("String").Params().String().Block(
+		jen.Return(jen.Qual("fmt", "Sprintf").Call(
+			jen.Lit("%s: %v -> %v"), jen.Id("c").Dot("Path"), jen.Id("c").Dot("Old"), jen.Id("c").Dot("New"),
+		)),
+	)
+
+	return f.Render(w)
+}
+
+func generateEqualMethod(f *jen.File, g *equalGenerator) {
+	structName := g.structDef.Name
+
+	body := []jen.Code{
+		jen.If(jen.Id("p").Op("==").Nil().Op("||").Id("o").Op("==").Nil()).Block(
+			jen.Return(jen.Id("p").Op("==").Id("o")),
+		),
+	}
+
+	for _, field := range g.structDef.Fields {
+		body = append(body, jen.If(g.fieldDiffers(field)).Block(
+			jen.Return(jen.False()),
+		))
+	}
+	body = append(body, jen.Return(jen.True()))
+
+	f.Func().Params(
+		jen.Id("p").Op("*").Id(structName),
+	).Id("Equal").Params(
+		jen.Id("o").Op("*").Id(structName),
+	).Bool().Block(body...)
+}
+
+func generateDiffMethod(f *jen.File, g *equalGenerator) {
+	structName := g.structDef.Name
+
+	body := []jen.Code{
+		jen.If(jen.Id("p").Op("==").Nil()).Block(
+			jen.Id("p").Op("=").Op("&").Id(structName).Values(),
+		),
+		jen.If(jen.Id("o").Op("==").Nil()).Block(
+			jen.Id("o").Op("=").Op("&").Id(structName).Values(),
+		),
+		jen.Var().Id("changes").Index().Id("FieldChange"),
+	}
+
+	for _, field := range g.structDef.Fields {
+		// Nested @equal structs report their own changes under the field path
+		if ident, ok := parseType(field.Type).(*ast.Ident); ok && g.hasEqual(ident.Name) {
+			body = append(body, jen.For(
+				jen.List(jen.Id("_"), jen.Id("change")).Op(":=").Range().
+					Id("p").Dot(field.Name).Dot("Diff").Call(jen.Op("&").Id("o").Dot(field.Name)),
+			).Block(
+				jen.Id("change").Dot("Path").Op("=").Lit(field.Name+".").Op("+").Id("change").Dot("Path"),
+				jen.Id("changes").Op("=").Append(jen.Id("changes"), jen.Id("change")),
+			))
+			continue
+		}
+
+		body = append(body, jen.If(g.fieldDiffers(field)).Block(
+			jen.Id("changes").Op("=").Append(jen.Id("changes"), jen.Id("FieldChange").Values(
+				jen.Id("Path").Op(":").Lit(field.Name),
+				jen.Id("Old").Op(":").Id("p").Dot(field.Name),
+				jen.Id("New").Op(":").Id("o").Dot(field.Name),
+			)),
+		))
+	}
+	body = append(body, jen.Return(jen.Id("changes")))
+
+	f.Func().Params(
+		jen.Id("p").Op("*").Id(structName),
+	).Id("Diff").Params(
+		jen.Id("o").Op("*").Id(structName),
+	).Index().Id("FieldChange").Block(body...)
+}
+
+// equalGenerator renders field comparisons for one struct, emitting helper
+// functions for composite types so Equal and Diff can share them.
+type equalGenerator struct {
+	structDef     *parser.StructDef
+	importAliases map[string]string
+	helpers       helperSet
+}
+
+func (g *equalGenerator) fieldDiffers(field parser.StructField) *jen.Statement {
+	return g.differs(
+		jen.Id("p").Dot(field.Name),
+		jen.Id("o").Dot(field.Name),
+		parseType(field.Type),
+		"equal"+g.structDef.Name+field.Name,
+	)
+}
+
+// hasEqual reports whether the named type in the same package gets a
+// generated Equal method.
+func (g *equalGenerator) hasEqual(name string) bool {
+	if name == g.structDef.Name {
+		return g.structDef.Annotations.Equal
+	}
+	return g.structDef.Siblings[name].Equal
+}
+
+// differs returns an expression reporting whether a and b, both of type expr,
+// hold different values. Composite types are compared by a helper function
+// named helperName.
+func (g *equalGenerator) differs(a, b *jen.Statement, expr ast.Expr, helperName string) *jen.Statement {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case t.Name == "any":
+			return jen.Op("!").Qual("reflect", "DeepEqual").Call(a, b)
+		case t.Name == "string" || t.Name == "bool" || t.Name == "error" || isNumeric(t.Name):
+			return a.Op("!=").Add(b)
+		case g.hasEqual(t.Name):
+			return jen.Op("!").Add(a).Dot("Equal").Call(jen.Op("&").Add(b))
+		}
+	case *ast.SelectorExpr:
+		if typeName(t) == "time.Time" {
+			return jen.Op("!").Add(a).Dot("Equal").Call(b)
+		}
+	case *ast.StarExpr:
+		if ident, ok := t.X.(*ast.Ident); ok && g.hasEqual(ident.Name) {
+			return jen.Op("!").Add(a).Dot("Equal").Call(b)
+		}
+		g.addHelper(helperName, expr, []jen.Code{
+			jen.If(jen.Id("a").Op("==").Nil().Op("||").Id("b").Op("==").Nil()).Block(
+				jen.Return(jen.Id("a").Op("==").Id("b")),
+			),
+			jen.List(jen.Id("av"), jen.Id("bv")).Op(":=").List(jen.Op("*").Id("a"), jen.Op("*").Id("b")),
+			jen.If(g.differs(
+				jen.Id("av"), jen.Id("bv"), t.X, helperName+"Elem",
+			)).Block(
+				jen.Return(jen.False()),
+			),
+			jen.Return(jen.True()),
+		})
+		return jen.Op("!").Id(helperName).Call(a, b)
+	case *ast.ArrayType:
+		g.addHelper(helperName, expr, []jen.Code{
+			jen.If(jen.Len(jen.Id("a")).Op("!=").Len(jen.Id("b"))).Block(
+				jen.Return(jen.False()),
+			),
+			jen.For(jen.Id("i").Op(":=").Range().Id("a")).Block(
+				jen.If(g.differs(
+					jen.Id("a").Index(jen.Id("i")), jen.Id("b").Index(jen.Id("i")), t.Elt, helperName+"Elem",
+				)).Block(
+					jen.Return(jen.False()),
+				),
+			),
+			jen.Return(jen.True()),
+		})
+		return jen.Op("!").Id(helperName).Call(a, b)
+	case *ast.MapType:
+		g.addHelper(helperName, expr, []jen.Code{
+			jen.If(jen.Len(jen.Id("a")).Op("!=").Len(jen.Id("b"))).Block(
+				jen.Return(jen.False()),
+			),
+			jen.For(jen.List(jen.Id("k"), jen.Id("av")).Op(":=").Range().Id("a")).Block(
+				jen.List(jen.Id("bv"), jen.Id("ok")).Op(":=").Id("b").Index(jen.Id("k")),
+				jen.If(jen.Op("!").Id("ok").Op("||").Add(g.differs(
+					jen.Id("av"), jen.Id("bv"), t.Value, helperName+"Value",
+				))).Block(
+					jen.Return(jen.False()),
+				),
+			),
+			jen.Return(jen.True()),
+		})
+		return jen.Op("!").Id(helperName).Call(a, b)
+	}
+
+	return jen.Op("!").Qual("reflect", "DeepEqual").Call(a, b)
+}
+
+// addHelper records func helperName(a, b T) bool with the given body, once.
+func (g *equalGenerator) addHelper(helperName string, expr ast.Expr, body []jen.Code) {
+	paramType := qualifiedType(expr, g.importAliases)
+	g.helpers.add(helperName, jen.Func().Id(helperName).Params(
+		jen.List(jen.Id("a"), jen.Id("b")).Add(paramType),
+	).Bool().Block(body...))
+}
+
+// typeName renders a package qualified type name such as time.Time.
+func typeName(sel *ast.SelectorExpr) string {
+	if pkg, ok := sel.X.(*ast.Ident); ok {
+		return pkg.Name + "." + sel.Sel.Name
+	}
+	return ""
+}
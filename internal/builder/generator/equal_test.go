@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestGenerateEqual(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "Customer",
+		PackageStr: "testmodel",
+		Fields: []parser.StructField{
+			{Name: "Name", Type: "string"},
+			{Name: "Home", Type: "Address"},
+			{Name: "Tags", Type: "[]string"},
+			{Name: "Attrs", Type: "map[string]int"},
+			{Name: "Nick", Type: "*string"},
+			{Name: "Joined", Type: "time.Time"},
+			{Name: "Extra", Type: "any"},
+			{Name: "Parent", Type: "*Customer"},
+		},
+		Imports: []string{
+			`"time"`,
+		},
+		Annotations: parser.BuilderAnnotations{
+			Equal: true,
+		},
+		Siblings: map[string]parser.BuilderAnnotations{
+			"Address": {Equal: true},
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "customer_equal.go")
+
+	if err := GenerateEqual(structDef, "testmodel", outputFile); err != nil {
+		t.Fatalf("GenerateEqual failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	generated := string(content)
+	t.Logf("Generated code:\n%s", generated)
+
+	expected := []string{
+		"func (p *Customer) Equal(o *Customer) bool",
+		"if p.Name != o.Name {",
+		"if !p.Home.Equal(&o.Home) {",
+		"if !equalCustomerTags(p.Tags, o.Tags) {",
+		"if !equalCustomerAttrs(p.Attrs, o.Attrs) {",
+		"if !equalCustomerNick(p.Nick, o.Nick) {",
+		"if !p.Joined.Equal(o.Joined) {",
+		"if !reflect.DeepEqual(p.Extra, o.Extra) {",
+		"if !p.Parent.Equal(o.Parent) {",
+		"func (p *Customer) Diff(o *Customer) []FieldChange",
+		`changes = append(changes, FieldChange{Path: "Name", Old: p.Name, New: o.Name})`,
+		"for _, change := range p.Home.Diff(&o.Home) {",
+		`change.Path = "Home." + change.Path`,
+		"func equalCustomerTags(a, b []string) bool",
+		"func equalCustomerAttrs(a, b map[string]int) bool",
+		"func equalCustomerNick(a, b *string) bool",
+	}
+
+	for _, item := range expected {
+		if !strings.Contains(generated, item) {
+			t.Errorf("Generated code missing: %s", item)
+		}
+	}
+}
+
+func TestGenerateFieldChange(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "field_change.go")
+
+	if err := GenerateFieldChange("testmodel", outputFile); err != nil {
+		t.Fatalf("GenerateFieldChange failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	generated := string(content)
+	for _, item := range []string{
+		"package testmodel",
+		"type FieldChange struct",
+		"func (c FieldChange) String() string",
+	} {
+		if !strings.Contains(generated, item) {
+			t.Errorf("Generated code missing: %s", item)
+		}
+	}
+}
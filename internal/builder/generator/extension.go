@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/token"
+	"slices"
+	"strconv"
+	"text/template"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ExtensionData is the data extension templates are executed with, once for
+// each struct of a generated file.
+type ExtensionData struct {
+	Struct    *parser.StructDef // struct, with its settings resolved
+	Generator string            // generator writing the file, such as builder or equal
+	Package   string            // package of the generated file
+}
+
+// ParseExtension parses an extension template: Go declarations, such as
+// house-style methods, added to the files of a generator. Besides the
+// text/template builtins, extensions can call:
+//
+//	import "path"      imports a package into the generated file
+//	paramName "Field"  the parameter name the generator uses for a field
+func ParseExtension(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(extensionFuncs(nil)).Parse(text)
+}
+
+// extensionFuncs returns the functions of extension templates, recording
+// the packages imported by an execution in imports.
+func extensionFuncs(imports *[]string) template.FuncMap {
+	return template.FuncMap{
+		"import": func(path string) string {
+			if imports != nil && !slices.Contains(*imports, path) {
+				*imports = append(*imports, path)
+			}
+			return ""
+		},
+		"paramName": paramName,
+	}
+}
+
+// Extend adds the declarations of extensions, executed for each of data,
+// to the generated file src. A function or method declared by an extension
+// replaces the generated one of the same name, so extensions can override
+// methods such as Build as well as add new ones. Imports asked for by the
+// extensions are added and those only used by replaced declarations are
+// removed.
+func Extend(src []byte, extensions []*template.Template, data []ExtensionData) ([]byte, error) {
+	if len(extensions) == 0 || len(data) == 0 || len(src) == 0 {
+		return src, nil
+	}
+
+	var added bytes.Buffer
+	var imports []string
+	declared := make(map[string]string)
+	for _, d := range data {
+		for _, extension := range extensions {
+			tmpl, err := extension.Clone()
+			if err != nil {
+				return nil, err
+			}
+			var snippet bytes.Buffer
+			if err := tmpl.Funcs(extensionFuncs(&imports)).Execute(&snippet, d); err != nil {
+				return nil, fmt.Errorf("extension %s: %w", extension.Name(), err)
+			}
+
+			// Parse each snippet on its own to blame the right template. The
+			// package clause shares the first line, so positions match the
+			// snippet.
+			fset := token.NewFileSet()
+			file, err := goparser.ParseFile(fset, extension.Name(), append([]byte("package p;"), snippet.Bytes()...), 0)
+			if err != nil {
+				return nil, fmt.Errorf("extension for %s: %w", d.Struct.Name, err)
+			}
+			for _, decl := range file.Decls {
+				key := funcKey(decl)
+				if key == "" {
+					continue
+				}
+				if other, ok := declared[key]; ok {
+					return nil, fmt.Errorf("extension %s: %s is also declared by %s", extension.Name(), key, other)
+				}
+				declared[key] = extension.Name()
+			}
+
+			added.WriteString("\n")
+			added.Write(snippet.Bytes())
+			added.WriteString("\n")
+		}
+	}
+
+	combined := make([]byte, 0, len(src)+added.Len())
+	combined = append(combined, src...)
+	combined = append(combined, added.Bytes()...)
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "", combined, goparser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("extending generated code: %w", err)
+	}
+	generatedEnd := fset.File(file.Package).Pos(len(src))
+
+	// Imports are only removed when the replaced declarations were their
+	// last users, as the package names of other imports are only guessed
+	used := make(map[string]bool)
+	for _, spec := range file.Imports {
+		path := importPath(spec)
+		used[path] = astutil.UsesImport(file, path)
+	}
+
+	// Drop the generated declarations replaced by extensions, along with
+	// the comments inside them
+	var removed [][2]token.Pos
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		if decl.Pos() < generatedEnd {
+			if _, ok := declared[funcKey(decl)]; ok {
+				start := decl.Pos()
+				if doc := decl.(*ast.FuncDecl).Doc; doc != nil {
+					start = doc.Pos()
+				}
+				removed = append(removed, [2]token.Pos{start, decl.End()})
+				continue
+			}
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+	file.Comments = slices.DeleteFunc(file.Comments, func(c *ast.CommentGroup) bool {
+		return slices.ContainsFunc(removed, func(r [2]token.Pos) bool {
+			return c.Pos() >= r[0] && c.End() <= r[1]
+		})
+	})
+
+	for _, spec := range slices.Clone(file.Imports) {
+		path := importPath(spec)
+		if used[path] && !astutil.UsesImport(file, path) {
+			name := ""
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			astutil.DeleteNamedImport(fset, file, name, path)
+		}
+	}
+	for _, path := range imports {
+		astutil.AddImport(fset, file, path)
+	}
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		return nil, fmt.Errorf("formatting extended code: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// funcKey identifies the function or method declared by decl, by its name
+// qualified with the receiver type for methods. It is empty for other
+// declarations.
+func funcKey(decl ast.Decl) string {
+	fn, ok := decl.(*ast.FuncDecl)
+	if !ok {
+		return ""
+	}
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	switch generic := recv.(type) {
+	case *ast.IndexExpr:
+		recv = generic.X
+	case *ast.IndexListExpr:
+		recv = generic.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// importPath returns the unquoted path of spec.
+func importPath(spec *ast.ImportSpec) string {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return spec.Path.Value
+	}
+	return path
+}
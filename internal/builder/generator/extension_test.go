@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"text/template"
+
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestExtend(t *testing.T) {
+	structDef := &genparser.StructDef{
+		Name:       "Event",
+		PackageStr: "testmodel",
+		Fields: []genparser.StructField{
+			{Name: "Title", Type: "string"},
+			{Name: "Start", Type: "time.Time"},
+		},
+		Imports: []string{`"time"`},
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, structDef, "testmodel"); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	mustParse := func(name string, text string) *template.Template {
+		t.Helper()
+		tmpl, err := ParseExtension(name, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tmpl
+	}
+	extensions := []*template.Template{
+		mustParse("trace.tmpl", `{{import "context"}}
+// BuildContext builds the {{.Struct.Name}} within the span of ctx.
+func (b *{{.Struct.Name}}Builder) BuildContext(ctx context.Context) *{{.Struct.Name}} {
+	_ = ctx
+	return b.Build()
+}
+`),
+		mustParse("start.tmpl", `
+// WithStart sets the start to the one of another event.
+func (b *{{.Struct.Name}}Builder) WithStart({{paramName "Other"}} *{{.Struct.Name}}) *{{.Struct.Name}}Builder {
+	b.instance.Start = {{paramName "Other"}}.Start
+	return b
+}
+`),
+	}
+	data := []ExtensionData{{Struct: structDef, Generator: "builder", Package: "testmodel"}}
+
+	extended, err := Extend(buf.Bytes(), extensions, data)
+	if err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", extended, 0); err != nil {
+		t.Fatalf("extended code does not parse: %v\n%s", err, extended)
+	}
+	generated := string(extended)
+
+	for _, want := range []string{
+		"// " + Header,
+		`"context"`,
+		"func (b *EventBuilder) BuildContext(ctx context.Context) *Event",
+		"func (b *EventBuilder) WithStart(other *Event) *EventBuilder",
+		"func (b *EventBuilder) WithTitle(title string) *EventBuilder",
+	} {
+		if !strings.Contains(generated, want) {
+			t.Errorf("Extended code missing %q:\n%s", want, generated)
+		}
+	}
+	if n := strings.Count(generated, ") WithStart("); n != 1 {
+		t.Errorf("expected the extension to replace WithStart, found %d declarations:\n%s", n, generated)
+	}
+	if strings.Contains(generated, `"time"`) {
+		t.Errorf("Extended code still imports time, only used by the replaced setter:\n%s", generated)
+	}
+
+	if _, err := Extend(buf.Bytes(), append(extensions, extensions[0]), data); err == nil {
+		t.Error("expected an error for a method declared by two extensions")
+	}
+	broken := mustParse("broken.tmpl", "func (b *{{.Struct.Name}}Builder) {")
+	if _, err := Extend(buf.Bytes(), []*template.Template{broken}, data); err == nil || !strings.Contains(err.Error(), "broken.tmpl") {
+		t.Errorf("expected an error naming the broken extension, got %v", err)
+	}
+	if unchanged, err := Extend(buf.Bytes(), nil, data); err != nil || !bytes.Equal(unchanged, buf.Bytes()) {
+		t.Error("Extend without extensions changed the generated code")
+	}
+}
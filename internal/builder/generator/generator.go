@@ -2,6 +2,13 @@ package generator
 
 import (
 	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/nanostack-dev/generators/internal/builder/parser"
@@ -19,49 +26,91 @@ func normalizeMethodName(name string, prefix string) string {
 	return prefix + name
 }
 
+// Generate writes the builder for structDef to outputFile, or to the file named
+// by @builder:output next to it.
 func Generate(structDef *parser.StructDef, packageName string, outputFile string) error {
+	// Override output file if specified in annotations, next to the original
+	if structDef != nil && structDef.Annotations.Output != "" {
+		outputFile = filepath.Join(filepath.Dir(outputFile), strings.ReplaceAll(
+			structDef.Annotations.Output, "{name}", strings.ToLower(structDef.Name),
+		))
+	}
+
+	return writeFile(outputFile, func(w io.Writer) error {
+		return Render(w, structDef, packageName)
+	})
+}
+
+// Render writes the builder source for structDef to w. Nothing is written
+// for structs annotated with @builder:skip.
+func Render(w io.Writer, structDef *parser.StructDef, packageName string) error {
 	if structDef == nil {
 		return fmt.Errorf("structDef cannot be nil")
 	}
+	return RenderBuilders(w, []*parser.StructDef{structDef}, packageName)
+}
 
-	if structDef.Annotations.Skip {
+// RenderBuilders writes the builders of structDefs, all declared in the same
+// package, to w as a single file with one import block. Builders are sorted
+// by struct name so the file does not depend on where the structs are
+// declared. Structs annotated with @builder:skip are left out, and nothing
+// is written when no struct remains.
+func RenderBuilders(w io.Writer, structDefs []*parser.StructDef, packageName string) error {
+	var builders []*parser.StructDef
+	for _, structDef := range structDefs {
+		if structDef == nil {
+			return fmt.Errorf("structDef cannot be nil")
+		}
+		if !structDef.Annotations.Skip {
+			builders = append(builders, structDef)
+		}
+	}
+	if len(builders) == 0 {
 		return nil
 	}
-
-	if packageName == "" {
-		packageName = structDef.PackageStr
+	slices.SortStableFunc(builders, func(a, b *parser.StructDef) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	f, _ := newFile(builders[0], packageName)
+	for _, structDef := range builders {
+		// Each struct qualifies types through the imports of its own file
+		importAliases := importAliasesOf(structDef)
+		f.ImportNames(importAliases)
+		generateBuilder(f, structDef, importAliases)
 	}
 
-	// Override package name if specified in annotations
-	if structDef.Annotations.Package != "" {
-		packageName = structDef.Annotations.Package
-	}
+	return f.Render(w)
+}
 
-	// Override output file if specified in annotations
-	if structDef.Annotations.Output != "" {
-		outputFile = strings.ReplaceAll(
-			structDef.Annotations.Output, "{name}", strings.ToLower(structDef.Name),
-		)
+// SetterName returns the name of the builder method generated to set field
+// of structDef, or false when it has none because the method is
+// implemented by hand through @builder:custom.
+func SetterName(structDef *parser.StructDef, field parser.StructField) (string, bool) {
+	prefix := structDef.Annotations.Prefix
+	if prefix == "" {
+		prefix = "With"
 	}
-
-	f := jen.NewFile(packageName)
-	f.HeaderComment("Code generated by nanostack/generator; DO NOT EDIT.")
-
-	// Add imports with proper handling for standard packages
-	importAliases := make(map[string]string)
-	for _, imp := range structDef.Imports {
-		cleanPath := strings.Trim(imp, `"`)
-		parts := strings.Split(cleanPath, "/")
-		if len(parts) > 0 {
-			pkgName := parts[len(parts)-1]
-			importAliases[cleanPath] = pkgName
-			fmt.Printf("Added import - Path: %s, Alias: %s\n", cleanPath, pkgName)
+	if field.CustomGen {
+		return "", false
+	}
+	methodName := prefix + field.Name
+	for _, customMethod := range structDef.Annotations.CustomMethods {
+		if normalizeMethodName(methodName, prefix) == normalizeMethodName(customMethod, prefix) {
+			return "", false
 		}
 	}
 
-	fmt.Printf("Final importAliases map: %+v\n", importAliases)
-	f.ImportNames(importAliases)
+	// Immutable builders copy the instance in With methods, whatever the
+	// prefix
+	if structDef.Annotations.Immutable {
+		return "With" + field.Name, true
+	}
+	return methodName, true
+}
 
+// generateBuilder adds the builder type of structDef and its methods to f.
+func generateBuilder(f *jen.File, structDef *parser.StructDef, importAliases map[string]string) {
 	builderName := structDef.Name + "Builder"
 
 	// Generate builder struct
@@ -74,34 +123,21 @@ func Generate(structDef *parser.StructDef, packageName string, outputFile string
 	if structDef.Annotations.Constructor != "" {
 		constructorName = structDef.Annotations.Constructor
 	}
-	generateConstructor(f, builderName, structDef.Name, constructorName)
+	generateConstructor(f, builderName, structDef, constructorName)
 
 	// Generate ToBuilder method
 	generateToBuilder(f, builderName, structDef)
 
 	// Generate setter methods for each field
-	prefix := structDef.Annotations.Prefix
-	if prefix == "" {
-		prefix = "With"
-	}
-
 	for _, field := range structDef.Fields {
-		methodName := prefix + field.Name
-		for _, customMethod := range structDef.Annotations.CustomMethods {
-			if normalizeMethodName(methodName, prefix) == normalizeMethodName(
-				customMethod, prefix,
-			) {
-				field.CustomGen = true
-				break
-			}
+		setterName, ok := SetterName(structDef, field)
+		if !ok {
+			continue
 		}
-
-		if !field.CustomGen {
-			if structDef.Annotations.Immutable {
-				generateCopyMethod(f, builderName, field, structDef.Name, importAliases)
-			} else {
-				generateWithMethod(f, builderName, field, structDef.Name, prefix, importAliases)
-			}
+		if structDef.Annotations.Immutable {
+			generateCopyMethod(f, builderName, field, structDef.Name, importAliases)
+		} else {
+			generateWithMethod(f, builderName, field, structDef.Name, setterName, importAliases)
 		}
 	}
 
@@ -124,7 +160,38 @@ func Generate(structDef *parser.StructDef, packageName string, outputFile string
 		jen.Return(jen.Id("b").Dot("instance")),
 	)
 
-	return f.Save(outputFile)
+	// Validation comes on top of Build, which keeps its signature
+	if structDef.Annotations.Validate {
+		generateValidate(f, builderName, structDef)
+		generateBuildValidated(f, builderName, structDef)
+	}
+}
+
+// generateValidate adds a Validate method rejecting an instance whose
+// required fields are empty.
+func generateValidate(f *jen.File, builderName string, structDef *parser.StructDef) {
+	body := []jen.Code{jen.Id("p").Op(":=").Id("b").Dot("instance")}
+	body = append(body, generateRequiredChecks(structDef, "p")...)
+	body = append(body, jen.Return(jen.Nil()))
+	f.Func().Params(
+		jen.Id("b").Op("*").Id(builderName),
+	).Id("Validate").Params().Error().Block(body...)
+}
+
+// generateBuildValidated adds a BuildValidated method returning the instance
+// once Validate accepts it.
+func generateBuildValidated(f *jen.File, builderName string, structDef *parser.StructDef) {
+	f.Func().Params(
+		jen.Id("b").Op("*").Id(builderName),
+	).Id("BuildValidated").Params().Params(jen.Op("*").Id(structDef.Name), jen.Error()).Block(
+		jen.If(
+			jen.Err().Op(":=").Id("b").Dot("Validate").Call(),
+			jen.Err().Op("!=").Nil(),
+		).Block(
+			jen.Return(jen.Nil(), jen.Err()),
+		),
+		jen.Return(jen.Id("b").Dot("instance"), jen.Nil()),
+	)
 }
 
 func generateMappedMethod(f *jen.File, builderName string, fromMethod, toMethod string) {
@@ -150,16 +217,16 @@ func generateWithMethod(
 	builderName string,
 	field parser.StructField,
 	structName string,
-	prefix string,
+	methodName string,
 	importAliases map[string]string,
 ) {
 	paramType := getQualifiedType(field.Type, importAliases)
 	f.Func().Params(
 		jen.Id("b").Op("*").Id(builderName),
-	).Id(prefix+field.Name).Params(
-		jen.Id(strings.ToLower(string(field.Name[0]))+field.Name[1:]).Add(paramType),
+	).Id(methodName).Params(
+		jen.Id(paramName(field.Name)).Add(paramType),
 	).Op("*").Id(builderName).Block(
-		jen.Id("b").Dot("instance").Dot(field.Name).Op("=").Id(strings.ToLower(field.Name)),
+		jen.Id("b").Dot("instance").Dot(field.Name).Op("=").Id(paramName(field.Name)),
 		jen.Return(jen.Id("b")),
 	)
 }
@@ -187,17 +254,97 @@ func generateCopyMethod(
 	)
 }
 
-func generateConstructor(f *jen.File, builderName, structName, constructorName string) {
+// writeFile saves the source produced by render to outputFile, leaving the
+// disk untouched when render produces nothing.
+func writeFile(outputFile string, render func(w io.Writer) error) error {
+	return WriteTo(DirSink{}, outputFile, render)
+}
+
+// newFile creates the jen file for structDef, resolving the package name and
+// registering the source file's imports. The returned map associates each
+// import path with the package name used to qualify types.
+func newFile(structDef *parser.StructDef, packageName string) (*jen.File, map[string]string) {
+	if packageName == "" {
+		packageName = structDef.PackageStr
+	}
+
+	// Override package name if specified in annotations
+	if structDef.Annotations.Package != "" {
+		packageName = structDef.Annotations.Package
+	}
+
+	f := jen.NewFile(packageName)
+	f.HeaderComment(Header)
+
+	importAliases := importAliasesOf(structDef)
+	f.ImportNames(importAliases)
+
+	return f, importAliases
+}
+
+// importAliasesOf associates each import path of the file declaring
+// structDef with the package name used to qualify types.
+func importAliasesOf(structDef *parser.StructDef) map[string]string {
+	// Add imports with proper handling for standard packages
+	importAliases := make(map[string]string)
+	for _, imp := range structDef.Imports {
+		cleanPath := strings.Trim(imp, `"`)
+		parts := strings.Split(cleanPath, "/")
+		if len(parts) > 0 {
+			pkgName := parts[len(parts)-1]
+			importAliases[cleanPath] = pkgName
+		}
+	}
+	return importAliases
+}
+
+func generateConstructor(
+	f *jen.File, builderName string, structDef *parser.StructDef, constructorName string,
+) {
 	f.Func().Id(constructorName).Params().Op("*").Id(builderName).Block(
 		jen.Return(
 			jen.Op("&").Id(builderName).Values(
-				jen.Id("instance").Op(":").Op("&").Id(structName).Values(),
+				jen.Id("instance").Op(":").Op("&").Id(structDef.Name).Values(
+					generateDefaultValues(structDef.Fields)...,
+				),
 			),
 		),
 	)
 }
 
+// generateDefaultValues returns the composite literal entries for fields that
+// carry a `default` struct tag. String fields take the tag verbatim, any other
+// type treats it as a Go expression.
+func generateDefaultValues(fields []parser.StructField) []jen.Code {
+	var values []jen.Code
+	for _, field := range fields {
+		value, ok := field.Default()
+		if !ok {
+			continue
+		}
+		values = append(values, jen.Id(field.Name).Op(":").Add(defaultValue(value, field.Type)))
+	}
+	return values
+}
+
+// defaultValue renders the `default` tag value for a field of fieldType.
+func defaultValue(value string, fieldType string) *jen.Statement {
+	if fieldType == "string" {
+		return jen.Lit(value)
+	}
+	return jen.Op(value)
+}
+
 func generateToBuilder(f *jen.File, builderName string, structDef *parser.StructDef) {
+	// Structs annotated with @clone are deep copied so the builder does not
+	// alias slices, maps or pointers of the source
+	instance := jen.Op("&").Id(structDef.Name).Values(
+		generateFieldAssignments(structDef.Fields, nil)...,
+	)
+	if structDef.Annotations.Clone {
+		instance = jen.Id("p").Dot("Clone").Call()
+	}
+
 	f.Func().Params(
 		jen.Id("p").Op("*").Id(structDef.Name),
 	).Id("ToBuilder").Params().Op("*").Id(builderName).Block(
@@ -206,40 +353,88 @@ func generateToBuilder(f *jen.File, builderName string, structDef *parser.Struct
 		),
 		jen.Return(
 			jen.Op("&").Id(builderName).Values(
-				jen.Id("instance").Op(":").Op("&").Id(structDef.Name).Values(
-					generateFieldAssignments(structDef.Fields, nil)...,
-				),
+				jen.Id("instance").Op(":").Add(instance),
 			),
 		),
 	)
 }
 
+// helperSet collects the unexported helper functions a generator emits after
+// its methods, declaring each name once.
+type helperSet struct {
+	names map[string]bool
+	funcs []jen.Code
+}
+
+func (h *helperSet) add(name string, fn jen.Code) {
+	if h.names == nil {
+		h.names = make(map[string]bool)
+	}
+	if h.names[name] {
+		return
+	}
+	h.names[name] = true
+	h.funcs = append(h.funcs, fn)
+}
+
+func (h *helperSet) render(f *jen.File) {
+	for _, fn := range h.funcs {
+		f.Add(fn)
+	}
+}
+
+// paramName derives a parameter name from a field name by lowering its first
+// letter, e.g. StartTime becomes startTime. Names that would collide with a Go
+// keyword, such as Type, get a "Value" suffix.
+func paramName(fieldName string) string {
+	name := strings.ToLower(fieldName[:1]) + fieldName[1:]
+	if token.IsKeyword(name) {
+		return name + "Value"
+	}
+	return name
+}
+
 // getQualifiedType returns a jen.Code for the type, handling package qualification
 func getQualifiedType(fieldType string, importAliases map[string]string) *jen.Statement {
-	// Handle slice types
-	if strings.HasPrefix(fieldType, "[]") {
-		return jen.Index().Add(getQualifiedType(fieldType[2:], importAliases))
+	expr := parseType(fieldType)
+	if expr == nil {
+		return jen.Id(fieldType)
 	}
+	return qualifiedType(expr, importAliases)
+}
 
-	// Handle pointer types
-	if strings.HasPrefix(fieldType, "*") {
-		return jen.Op("*").Add(getQualifiedType(fieldType[1:], importAliases))
+// parseType parses a field type as recorded by the parser, returning nil when
+// it is not a valid type expression.
+func parseType(fieldType string) ast.Expr {
+	expr, err := goparser.ParseExpr(fieldType)
+	if err != nil {
+		return nil
 	}
+	return expr
+}
 
-	// Handle package qualified types (e.g., time.Time, uuid.UUID)
-	if strings.Contains(fieldType, ".") {
-		parts := strings.SplitN(fieldType, ".", 2)
-		pkg := parts[0]
-		typeName := parts[1]
-
-		// Find the import path for the package
-		for importPath, alias := range importAliases {
-			if alias == pkg {
-				return jen.Qual(importPath, typeName)
+func qualifiedType(expr ast.Expr, importAliases map[string]string) *jen.Statement {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return jen.Op("*").Add(qualifiedType(t.X, importAliases))
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return jen.Index().Add(qualifiedType(t.Elt, importAliases))
+		}
+		return jen.Index(jen.Op(types.ExprString(t.Len))).Add(qualifiedType(t.Elt, importAliases))
+	case *ast.MapType:
+		return jen.Map(qualifiedType(t.Key, importAliases)).Add(qualifiedType(t.Value, importAliases))
+	case *ast.SelectorExpr:
+		// Handle package qualified types (e.g., time.Time, uuid.UUID)
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			for importPath, alias := range importAliases {
+				if alias == pkg.Name {
+					return jen.Qual(importPath, t.Sel.Name)
+				}
 			}
 		}
 	}
 
 	// Default case for basic types
-	return jen.Id(fieldType)
+	return jen.Id(types.ExprString(expr))
 }
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
@@ -60,6 +61,30 @@ func TestGenerate(t *testing.T) {
 				"func (b *UserBuilder) Build() *User",
 			},
 		},
+		{
+			name: "with_validate",
+			structDef: &parser.StructDef{
+				Name:       "Server",
+				PackageStr: "testmodel",
+				Fields: []parser.StructField{
+					{Name: "Host", Type: "string", Tags: map[string]string{"validate": "required"}},
+					{Name: "Port", Type: "int"},
+				},
+				Annotations: parser.BuilderAnnotations{
+					Validate: true,
+				},
+			},
+			packageName: "testmodel",
+			validateItems: []string{
+				"func (b *ServerBuilder) Validate() error",
+				`if p.Host == "" {`,
+				`return errors.New("Server.Host is required")`,
+				"func (b *ServerBuilder) Build() *Server",
+				"func (b *ServerBuilder) BuildAsPtr() *Server",
+				"func (b *ServerBuilder) BuildValidated() (*Server, error)",
+				"if err := b.Validate(); err != nil {",
+			},
+		},
 		{
 			name: "with_skip_annotation",
 			structDef: &parser.StructDef{
@@ -246,3 +271,51 @@ func TestGenerateWithTimeFields(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderBuilders(t *testing.T) {
+	structDefs := []*parser.StructDef{
+		{
+			Name:       "Team",
+			PackageStr: "testmodel",
+			Fields:     []parser.StructField{{Name: "Founded", Type: "time.Time"}},
+			Imports:    []string{`"time"`},
+		},
+		{
+			Name:        "Draft",
+			PackageStr:  "testmodel",
+			Annotations: parser.BuilderAnnotations{Skip: true},
+		},
+		{
+			Name:       "Person",
+			PackageStr: "testmodel",
+			Fields:     []parser.StructField{{Name: "Site", Type: "url.URL"}},
+			Imports:    []string{`"net/url"`},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderBuilders(&buf, structDefs, "testmodel"); err != nil {
+		t.Fatalf("RenderBuilders failed: %v", err)
+	}
+	generated := buf.String()
+
+	if n := strings.Count(generated, "import ("); n != 1 {
+		t.Errorf("expected one import block, got %d:\n%s", n, generated)
+	}
+	for _, want := range []string{
+		`"net/url"`,
+		`"time"`,
+		"func (b *PersonBuilder) WithSite(site url.URL) *PersonBuilder",
+		"func (b *TeamBuilder) WithFounded(founded time.Time) *TeamBuilder",
+	} {
+		if !strings.Contains(generated, want) {
+			t.Errorf("Generated code missing %q", want)
+		}
+	}
+	if strings.Contains(generated, "DraftBuilder") {
+		t.Error("Generated code contains the builder of a skipped struct")
+	}
+	if strings.Index(generated, "type PersonBuilder") > strings.Index(generated, "type TeamBuilder") {
+		t.Error("Builders are not sorted by struct name")
+	}
+}
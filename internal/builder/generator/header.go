@@ -0,0 +1,188 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Header is the comment starting every generated file. It follows the Go
+// convention for marking generated code.
+const Header = "Code generated by nanostack/generator; DO NOT EDIT."
+
+// Version identifies the code this package generates and is part of every
+// input hash. Bump it whenever the generated code changes, so files
+// generated by an older version are not mistaken for up to date.
+const Version = "2"
+
+// inputsPrefix starts the header line recording the input hash.
+const inputsPrefix = "// Generator inputs: "
+
+// flagsPrefix starts the header line recording the flags a file was
+// generated with.
+const flagsPrefix = "// Generator flags: "
+
+// InputHash returns a digest of the inputs a generated file is rendered
+// from, such as the struct definition, the package name and the generator,
+// together with Version. Inputs are encoded as JSON, so they must be
+// encodable and describe everything the output depends on.
+func InputHash(inputs ...any) (string, error) {
+	encoded, err := json.Marshal(append([]any{Version}, inputs...))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// StampInputHash records hash in src, on the line following the generated
+// code header. src is returned unchanged when it does not start with the
+// header.
+func StampInputHash(src []byte, hash string) []byte {
+	header := []byte("// " + Header + "\n")
+	if !bytes.HasPrefix(src, header) {
+		return src
+	}
+
+	stamped := make([]byte, 0, len(src)+len(inputsPrefix)+len(hash)+1)
+	stamped = append(stamped, header...)
+	stamped = append(stamped, inputsPrefix+hash+"\n"...)
+	return append(stamped, src[len(header):]...)
+}
+
+// RecordedInputHash returns the input hash recorded in the header of src by
+// StampInputHash.
+func RecordedInputHash(src []byte) (string, bool) {
+	header := []byte("// " + Header + "\n" + inputsPrefix)
+	if !bytes.HasPrefix(src, header) {
+		return "", false
+	}
+	hash, _, ok := bytes.Cut(src[len(header):], []byte("\n"))
+	return string(hash), ok
+}
+
+// StampFlags records flags, the command line flags giving the settings of
+// the generated file src, on the line following its input hash, so tools
+// checking the file can plan it again with the same settings. Flags holding
+// spaces or quotes are quoted. src is returned unchanged when flags is
+// empty or src has no recorded input hash.
+func StampFlags(src []byte, flags []string) []byte {
+	if len(flags) == 0 {
+		return src
+	}
+	hash, ok := RecordedInputHash(src)
+	if !ok {
+		return src
+	}
+	end := len("// "+Header+"\n"+inputsPrefix+hash) + 1
+
+	quoted := make([]string, len(flags))
+	for i, flag := range flags {
+		quoted[i] = flag
+		if flag == "" || strings.ContainsAny(flag, " \t\"\\") {
+			quoted[i] = strconv.Quote(flag)
+		}
+	}
+	line := flagsPrefix + strings.Join(quoted, " ") + "\n"
+
+	stamped := make([]byte, 0, len(src)+len(line))
+	stamped = append(stamped, src[:end]...)
+	stamped = append(stamped, line...)
+	return append(stamped, src[end:]...)
+}
+
+// RecordedFlags returns the flags recorded in the header of src by
+// StampFlags, and false when it records none.
+func RecordedFlags(src []byte) ([]string, bool) {
+	hash, ok := RecordedInputHash(src)
+	if !ok {
+		return nil, false
+	}
+	rest, ok := bytes.CutPrefix(src[len("// "+Header+"\n"+inputsPrefix+hash)+1:], []byte(flagsPrefix))
+	if !ok {
+		return nil, false
+	}
+	line, _, _ := bytes.Cut(rest, []byte("\n"))
+
+	var flags []string
+	for text := strings.TrimSpace(string(line)); text != ""; text = strings.TrimLeft(text, " ") {
+		if text[0] != '"' {
+			flag, after, _ := strings.Cut(text, " ")
+			flags = append(flags, flag)
+			text = after
+			continue
+		}
+		quoted, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return nil, false
+		}
+		flag, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, false
+		}
+		flags = append(flags, flag)
+		text = text[len(quoted):]
+	}
+	return flags, true
+}
+
+// HeaderData is the data available to the templates of custom file
+// headers.
+type HeaderData struct {
+	Version   string // generator version, see Version
+	Generator string // generator writing the file, such as builder or equal
+	Types     string // structs the file is generated for, comma separated
+	Sources   string // base names of the files declaring Types, comma separated
+	InputHash string // input hash recorded in the header
+}
+
+// InsertPreamble inserts comment and a //go:build line for the constraint
+// expression buildConstraint into the generated file src, after its header,
+// recorded input hash and flags. Lines of comment not starting with // are
+// commented out. Empty values are left out, and src is returned unchanged
+// when it does not start with the header.
+func InsertPreamble(src []byte, comment string, buildConstraint string) []byte {
+	if !IsGenerated(src) {
+		return src
+	}
+	end := len("// " + Header + "\n")
+	if _, ok := RecordedInputHash(src); ok {
+		end += bytes.IndexByte(src[end:], '\n') + 1
+	}
+	if bytes.HasPrefix(src[end:], []byte(flagsPrefix)) {
+		end += bytes.IndexByte(src[end:], '\n') + 1
+	}
+
+	var preamble bytes.Buffer
+	if comment = strings.TrimRight(comment, "\n"); comment != "" {
+		preamble.WriteString("\n")
+		for _, line := range strings.Split(comment, "\n") {
+			switch {
+			case strings.HasPrefix(line, "//"):
+				preamble.WriteString(line)
+			case line == "":
+				preamble.WriteString("//")
+			default:
+				preamble.WriteString("// " + line)
+			}
+			preamble.WriteString("\n")
+		}
+	}
+	if buildConstraint != "" {
+		preamble.WriteString("\n//go:build " + buildConstraint + "\n")
+	}
+
+	out := make([]byte, 0, len(src)+preamble.Len())
+	out = append(out, src[:end]...)
+	out = append(out, preamble.Bytes()...)
+	return append(out, src[end:]...)
+}
+
+// IsGenerated reports whether src starts with the header of the files this
+// package generates.
+func IsGenerated(src []byte) bool {
+	return bytes.HasPrefix(src, []byte("// "+Header+"\n"))
+}
@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestInputHash(t *testing.T) {
+	person := &parser.StructDef{
+		Name:   "Person",
+		Fields: []parser.StructField{{Name: "Name", Type: "string"}},
+	}
+
+	first, err := InputHash("builder", "model", person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InputHash("builder", "model", person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || !strings.HasPrefix(first, "sha256:") {
+		t.Errorf("InputHash() = %q then %q, want the same sha256 digest", first, second)
+	}
+
+	person.Fields = append(person.Fields, parser.StructField{Name: "Age", Type: "int"})
+	changed, err := InputHash("builder", "model", person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == first {
+		t.Error("InputHash() did not change with the struct definition")
+	}
+}
+
+func TestStampInputHash(t *testing.T) {
+	src := []byte("// " + Header + "\n\npackage model\n")
+
+	stamped := StampInputHash(src, "sha256:abc")
+	want := "// " + Header + "\n// Generator inputs: sha256:abc\n\npackage model\n"
+	if string(stamped) != want {
+		t.Errorf("StampInputHash() =\n%s\nwant:\n%s", stamped, want)
+	}
+
+	if hash, ok := RecordedInputHash(stamped); !ok || hash != "sha256:abc" {
+		t.Errorf("RecordedInputHash() = %q, %v", hash, ok)
+	}
+	if _, ok := RecordedInputHash(src); ok {
+		t.Error("RecordedInputHash() found a hash in an unstamped file")
+	}
+
+	handWritten := []byte("package model\n")
+	if !bytes.Equal(StampInputHash(handWritten, "sha256:abc"), handWritten) {
+		t.Error("StampInputHash() modified a file without the generated code header")
+	}
+
+	if !IsGenerated(src) || !IsGenerated(stamped) || IsGenerated(handWritten) {
+		t.Error("IsGenerated() should only report files starting with the header")
+	}
+}
+
+func TestStampFlags(t *testing.T) {
+	src := []byte("// " + Header + "\n\npackage model\n")
+	stamped := StampInputHash(src, "sha256:abc")
+	flags := []string{"-prefix=Set", "-header-file=legal notice.txt", `-build-constraint="quoted"`, ""}
+
+	withFlags := StampFlags(stamped, flags)
+	want := "// " + Header + "\n// Generator inputs: sha256:abc\n" +
+		`// Generator flags: -prefix=Set "-header-file=legal notice.txt" "-build-constraint=\"quoted\"" ""` + "\n\npackage model\n"
+	if string(withFlags) != want {
+		t.Fatalf("StampFlags() =\n%s\nwant:\n%s", withFlags, want)
+	}
+	if got, ok := RecordedFlags(withFlags); !ok || !slices.Equal(got, flags) {
+		t.Errorf("RecordedFlags() = %q, %v, want %q", got, ok, flags)
+	}
+	if hash, ok := RecordedInputHash(withFlags); !ok || hash != "sha256:abc" {
+		t.Errorf("RecordedInputHash() = %q, %v after StampFlags", hash, ok)
+	}
+
+	if !bytes.Equal(StampFlags(stamped, nil), stamped) {
+		t.Error("StampFlags() modified a file without flags")
+	}
+	if !bytes.Equal(StampFlags(src, flags), src) {
+		t.Error("StampFlags() modified a file without a recorded input hash")
+	}
+	if got, ok := RecordedFlags(stamped); ok {
+		t.Errorf("RecordedFlags() = %q, true for a file without flags", got)
+	}
+}
+
+func TestInsertPreamble(t *testing.T) {
+	header := "// " + Header + "\n"
+	stamped := header + "// Generator inputs: sha256:abc\n"
+	tests := []struct {
+		name            string
+		src             string
+		comment         string
+		buildConstraint string
+		want            string
+	}{
+		{
+			name: "nothing to insert",
+			src:  stamped + "\npackage model\n",
+			want: stamped + "\npackage model\n",
+		},
+		{
+			name:    "comment after the input hash",
+			src:     stamped + "\npackage model\n",
+			comment: "Copyright 2026 Acme\n\nLicensed under MIT\n",
+			want:    stamped + "\n// Copyright 2026 Acme\n//\n// Licensed under MIT\n\npackage model\n",
+		},
+		{
+			name:            "commented lines and build constraint",
+			src:             header + "\npackage model\n",
+			comment:         "// Copyright 2026 Acme",
+			buildConstraint: "linux && amd64",
+			want:            header + "\n// Copyright 2026 Acme\n\n//go:build linux && amd64\n\npackage model\n",
+		},
+		{
+			name:    "comment after the recorded flags",
+			src:     stamped + "// Generator flags: -prefix=Set\n\npackage model\n",
+			comment: "Copyright 2026 Acme",
+			want:    stamped + "// Generator flags: -prefix=Set\n\n// Copyright 2026 Acme\n\npackage model\n",
+		},
+		{
+			name:            "not generated",
+			src:             "package model\n",
+			buildConstraint: "linux",
+			want:            "package model\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(InsertPreamble([]byte(tt.src), tt.comment, tt.buildConstraint))
+			if got != tt.want {
+				t.Errorf("InsertPreamble() =\n%s\nwant:\n%s", got, tt.want)
+			}
+			if hash, ok := RecordedInputHash([]byte(got)); strings.Contains(tt.src, "Generator inputs") && (!ok || hash != "sha256:abc") {
+				t.Errorf("RecordedInputHash() = %q, %v after InsertPreamble", hash, ok)
+			}
+		})
+	}
+}
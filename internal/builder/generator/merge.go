@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GenerateMerge writes the options-struct helpers for structDef to outputFile:
+// Merge layers one set of options over another, WithDefaults fills unset
+// fields from their `default` tags and a Get<Field> getter returns the
+// effective value of each field. Pointer fields are considered set when
+// non-nil, other fields when they hold a non-zero value.
+func GenerateMerge(structDef *parser.StructDef, packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderMerge(w, structDef, packageName)
+	})
+}
+
+// RenderMerge writes the source GenerateMerge saves to w.
+func RenderMerge(w io.Writer, structDef *parser.StructDef, packageName string) error {
+	if structDef == nil {
+		return fmt.Errorf("structDef cannot be nil")
+	}
+
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	f, importAliases := newFile(structDef, packageName)
+
+	generateMergeMethod(f, structDef)
+	generateWithDefaults(f, structDef, importAliases)
+
+	for _, field := range structDef.Fields {
+		if field.CustomGen {
+			continue
+		}
+		generateGetter(f, structDef.Name, field, importAliases)
+	}
+
+	return f.Render(w)
+}
+
+func generateMergeMethod(f *jen.File, structDef *parser.StructDef) {
+	body := []jen.Code{
+		jen.Id("merged").Op(":=").Op("&").Id(structDef.Name).Values(),
+		jen.If(jen.Id("o").Op("!=").Nil()).Block(
+			jen.Op("*").Id("merged").Op("=").Op("*").Id("o"),
+		),
+		jen.If(jen.Id("other").Op("==").Nil()).Block(
+			jen.Return(jen.Id("merged")),
+		),
+	}
+
+	for _, field := range structDef.Fields {
+		body = append(body, jen.If(isSet(jen.Id("other").Dot(field.Name), field.Type)).Block(
+			jen.Id("merged").Dot(field.Name).Op("=").Id("other").Dot(field.Name),
+		))
+	}
+	body = append(body, jen.Return(jen.Id("merged")))
+
+	f.Func().Params(
+		jen.Id("o").Op("*").Id(structDef.Name),
+	).Id("Merge").Params(
+		jen.Id("other").Op("*").Id(structDef.Name),
+	).Op("*").Id(structDef.Name).Block(body...)
+}
+
+func generateWithDefaults(f *jen.File, structDef *parser.StructDef, importAliases map[string]string) {
+	body := []jen.Code{
+		jen.Id("merged").Op(":=").Id("o").Dot("Merge").Call(jen.Nil()),
+	}
+
+	for _, field := range structDef.Fields {
+		value, ok := field.Default()
+		if !ok {
+			continue
+		}
+
+		target := jen.Id("merged").Dot(field.Name)
+		if !strings.HasPrefix(field.Type, "*") {
+			body = append(body, jen.If(isZero(target.Clone(), field.Type)).Block(
+				target.Clone().Op("=").Add(defaultValue(value, field.Type)),
+			))
+			continue
+		}
+
+		elemType := strings.TrimPrefix(field.Type, "*")
+		name := paramName(field.Name)
+		body = append(body, jen.If(target.Clone().Op("==").Nil()).Block(
+			jen.Var().Id(name).Add(getQualifiedType(elemType, importAliases)).Op("=").Add(defaultValue(value, elemType)),
+			target.Clone().Op("=").Op("&").Id(name),
+		))
+	}
+	body = append(body, jen.Return(jen.Id("merged")))
+
+	f.Func().Params(
+		jen.Id("o").Op("*").Id(structDef.Name),
+	).Id("WithDefaults").Params().Op("*").Id(structDef.Name).Block(body...)
+}
+
+func generateGetter(
+	f *jen.File,
+	structName string,
+	field parser.StructField,
+	importAliases map[string]string,
+) {
+	value := jen.Id("o").Dot(field.Name)
+	valueType := field.Type
+	if strings.HasPrefix(field.Type, "*") {
+		value = jen.Op("*").Id("o").Dot(field.Name)
+		valueType = strings.TrimPrefix(field.Type, "*")
+	}
+
+	fallback := []jen.Code{
+		jen.Var().Id("zero").Add(getQualifiedType(valueType, importAliases)),
+		jen.Return(jen.Id("zero")),
+	}
+	if def, ok := field.Default(); ok {
+		fallback = []jen.Code{jen.Return(defaultValue(def, valueType))}
+	}
+
+	body := []jen.Code{
+		jen.If(
+			jen.Id("o").Op("!=").Nil().Op("&&").Add(isSet(jen.Id("o").Dot(field.Name), field.Type)),
+		).Block(
+			jen.Return(value),
+		),
+	}
+	body = append(body, fallback...)
+
+	f.Func().Params(
+		jen.Id("o").Op("*").Id(structName),
+	).Id("Get" + field.Name).Params().Add(getQualifiedType(valueType, importAliases)).Block(body...)
+}
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestGenerateMerge(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "ClientOptions",
+		PackageStr: "testmodel",
+		Fields: []parser.StructField{
+			{Name: "Timeout", Type: "*time.Duration", Tags: map[string]string{"default": "30 * time.Second"}},
+			{Name: "BaseURL", Type: "*string", Tags: map[string]string{"default": "https://example.com"}},
+			{Name: "Retries", Type: "*int"},
+			{Name: "Name", Type: "string", Tags: map[string]string{"default": "client"}},
+		},
+		Imports: []string{
+			`"time"`,
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "clientoptions_merge.go")
+
+	if err := GenerateMerge(structDef, "testmodel", outputFile); err != nil {
+		t.Fatalf("GenerateMerge failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	generated := string(content)
+	t.Logf("Generated code:\n%s", generated)
+
+	expected := []string{
+		`import "time"`,
+		"func (o *ClientOptions) Merge(other *ClientOptions) *ClientOptions",
+		"if other.Timeout != nil {",
+		`if other.Name != "" {`,
+		"func (o *ClientOptions) WithDefaults() *ClientOptions",
+		"var timeout time.Duration = 30 * time.Second",
+		`var baseURL string = "https://example.com"`,
+		`merged.Name = "client"`,
+		"func (o *ClientOptions) GetTimeout() time.Duration",
+		"func (o *ClientOptions) GetBaseURL() string",
+		"func (o *ClientOptions) GetRetries() int",
+		"func (o *ClientOptions) GetName() string",
+	}
+
+	for _, item := range expected {
+		if !strings.Contains(generated, item) {
+			t.Errorf("Generated code missing: %s", item)
+		}
+	}
+
+	if strings.Contains(generated, "merged.Retries = &") {
+		t.Error("WithDefaults should not assign fields without a default tag")
+	}
+}
@@ -0,0 +1,212 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GenerateOptions writes functional options for structDef to outputFile: an
+// option type, one option constructor per field, a New<Struct> constructor and
+// an ApplyOptions method. Defaults, required fields and @builder:validate
+// behave as they do for builders.
+func GenerateOptions(structDef *parser.StructDef, packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderOptions(w, structDef, packageName)
+	})
+}
+
+// RenderOptions writes the source GenerateOptions saves to w.
+func RenderOptions(w io.Writer, structDef *parser.StructDef, packageName string) error {
+	if structDef == nil {
+		return fmt.Errorf("structDef cannot be nil")
+	}
+
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	f, importAliases := newFile(structDef, packageName)
+
+	optionName := structDef.Name + "Option"
+
+	// Generate option type
+	f.Type().Id(optionName).Func().Params(jen.Op("*").Id(structDef.Name))
+
+	// Generate option constructors for each field
+	for _, field := range structDef.Fields {
+		if field.CustomGen {
+			continue
+		}
+		generateOptionFunc(f, optionName, field, structDef.Name, OptionFuncName(structDef, field), importAliases)
+	}
+
+	generateApplyOptions(f, optionName, structDef)
+	generateOptionsConstructor(f, optionName, structDef)
+
+	return f.Render(w)
+}
+
+// OptionFuncName returns the name of the option func setting field of
+// structDef. Option funcs are declared at package level, so the funcs of
+// two @options structs of a package clash when their names do.
+func OptionFuncName(structDef *parser.StructDef, field parser.StructField) string {
+	prefix := structDef.Annotations.Prefix
+	if prefix == "" {
+		prefix = "With"
+	}
+	return prefix + field.Name
+}
+
+func generateOptionFunc(
+	f *jen.File,
+	optionName string,
+	field parser.StructField,
+	structName string,
+	funcName string,
+	importAliases map[string]string,
+) {
+	paramType := getQualifiedType(field.Type, importAliases)
+	f.Func().Id(funcName).Params(
+		jen.Id(paramName(field.Name)).Add(paramType),
+	).Id(optionName).Block(
+		jen.Return(
+			jen.Func().Params(jen.Id("p").Op("*").Id(structName)).Block(
+				jen.Id("p").Dot(field.Name).Op("=").Id(paramName(field.Name)),
+			),
+		),
+	)
+}
+
+func generateApplyOptions(f *jen.File, optionName string, structDef *parser.StructDef) {
+	applyLoop := jen.For(jen.List(jen.Id("_"), jen.Id("opt")).Op(":=").Range().Id("opts")).Block(
+		jen.If(jen.Id("opt").Op("!=").Nil()).Block(
+			jen.Id("opt").Call(jen.Id("p")),
+		),
+	)
+
+	method := f.Func().Params(
+		jen.Id("p").Op("*").Id(structDef.Name),
+	).Id("ApplyOptions").Params(
+		jen.Id("opts").Op("...").Id(optionName),
+	)
+
+	if !structDef.Annotations.Validate {
+		method.Block(applyLoop)
+		return
+	}
+
+	body := []jen.Code{applyLoop}
+	body = append(body, generateRequiredChecks(structDef, "p")...)
+	body = append(body, jen.Return(jen.Nil()))
+	method.Error().Block(body...)
+}
+
+func generateOptionsConstructor(f *jen.File, optionName string, structDef *parser.StructDef) {
+	constructor := f.Func().Id("New" + structDef.Name).Params(
+		jen.Id("opts").Op("...").Id(optionName),
+	)
+
+	instance := jen.Id("p").Op(":=").Op("&").Id(structDef.Name).Values(
+		generateDefaultValues(structDef.Fields)...,
+	)
+
+	if !structDef.Annotations.Validate {
+		constructor.Op("*").Id(structDef.Name).Block(
+			instance,
+			jen.Id("p").Dot("ApplyOptions").Call(jen.Id("opts").Op("...")),
+			jen.Return(jen.Id("p")),
+		)
+		return
+	}
+
+	constructor.Params(jen.Op("*").Id(structDef.Name), jen.Error()).Block(
+		instance,
+		jen.If(
+			jen.Err().Op(":=").Id("p").Dot("ApplyOptions").Call(jen.Id("opts").Op("...")),
+			jen.Err().Op("!=").Nil(),
+		).Block(
+			jen.Return(jen.Nil(), jen.Err()),
+		),
+		jen.Return(jen.Id("p"), jen.Nil()),
+	)
+}
+
+// generateRequiredChecks returns statements rejecting a zero value in every
+// field of the named variable whose `validate` tag marks it as required.
+func generateRequiredChecks(structDef *parser.StructDef, name string) []jen.Code {
+	var checks []jen.Code
+	for _, field := range structDef.Fields {
+		if !field.Required() {
+			continue
+		}
+		checks = append(checks, jen.If(isZero(jen.Id(name).Dot(field.Name), field.Type)).Block(
+			jen.Return(jen.Qual("errors", "New").Call(
+				jen.Lit(fmt.Sprintf("%s.%s is required", structDef.Name, field.Name)),
+			)),
+		))
+	}
+	return checks
+}
+
+// isZero returns an expression reporting whether value holds the zero value of
+// fieldType, falling back to reflection for struct and named types.
+func isZero(value *jen.Statement, fieldType string) *jen.Statement {
+	return compareZero(value, fieldType, true)
+}
+
+// isSet is the negation of isZero.
+func isSet(value *jen.Statement, fieldType string) *jen.Statement {
+	return compareZero(value, fieldType, false)
+}
+
+func compareZero(value *jen.Statement, fieldType string, zero bool) *jen.Statement {
+	op := "!="
+	if zero {
+		op = "=="
+	}
+
+	switch {
+	case isNillable(fieldType):
+		return value.Op(op).Nil()
+	case fieldType == "string":
+		return value.Op(op).Lit("")
+	case isNumeric(fieldType):
+		return value.Op(op).Lit(0)
+	case fieldType == "bool":
+		if zero {
+			return jen.Op("!").Add(value)
+		}
+		return value
+	default:
+		isZero := jen.Qual("reflect", "ValueOf").Call(value).Dot("IsZero").Call()
+		if zero {
+			return isZero
+		}
+		return jen.Op("!").Add(isZero)
+	}
+}
+
+// isNillable reports whether nil is the zero value of fieldType.
+func isNillable(fieldType string) bool {
+	return strings.HasPrefix(fieldType, "*") ||
+		strings.HasPrefix(fieldType, "[]") ||
+		strings.HasPrefix(fieldType, "map[") ||
+		strings.HasPrefix(fieldType, "func") ||
+		strings.HasPrefix(fieldType, "chan") ||
+		fieldType == "error" || fieldType == "any" || fieldType == "interface{}"
+}
+
+func isNumeric(fieldType string) bool {
+	switch fieldType {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"float32", "float64", "complex64", "complex128", "byte", "rune":
+		return true
+	}
+	return false
+}
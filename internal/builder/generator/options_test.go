@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestGenerateOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		structDef     *parser.StructDef
+		expectError   bool
+		validateItems []string
+	}{
+		{
+			name: "basic_struct",
+			structDef: &parser.StructDef{
+				Name:       "Person",
+				PackageStr: "testmodel",
+				Fields: []parser.StructField{
+					{Name: "Name", Type: "string", Tags: map[string]string{"default": "anon"}},
+					{Name: "Age", Type: "int", Tags: map[string]string{"default": "18"}},
+				},
+			},
+			validateItems: []string{
+				"package testmodel",
+				"type PersonOption func(*Person)",
+				"func WithName(name string) PersonOption",
+				"func WithAge(age int) PersonOption",
+				"func (p *Person) ApplyOptions(opts ...PersonOption) {",
+				"func NewPerson(opts ...PersonOption) *Person",
+				`p := &Person{Name: "anon", Age: 18}`,
+			},
+		},
+		{
+			name: "with_validate",
+			structDef: &parser.StructDef{
+				Name:       "Server",
+				PackageStr: "testmodel",
+				Fields: []parser.StructField{
+					{Name: "Host", Type: "string", Tags: map[string]string{"validate": "required"}},
+					{Name: "Port", Type: "int", Tags: map[string]string{"validate": "required,gte=1"}},
+					{Name: "Labels", Type: "[]string"},
+				},
+				Annotations: parser.BuilderAnnotations{
+					Prefix:   "Set",
+					Validate: true,
+				},
+			},
+			validateItems: []string{
+				"func SetHost(host string) ServerOption",
+				"func SetLabels(labels []string) ServerOption",
+				"func (p *Server) ApplyOptions(opts ...ServerOption) error",
+				"func NewServer(opts ...ServerOption) (*Server, error)",
+				`if p.Host == "" {`,
+				`return errors.New("Server.Host is required")`,
+				"if p.Port == 0 {",
+			},
+		},
+		{
+			name:        "nil_struct_def",
+			structDef:   nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				outputFile := filepath.Join(t.TempDir(), tt.name+"_options.go")
+
+				err := GenerateOptions(tt.structDef, "", outputFile)
+				if tt.expectError {
+					if err == nil {
+						t.Error("expected error but got none")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				content, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+
+				generated := string(content)
+				for _, element := range tt.validateItems {
+					if !strings.Contains(generated, element) {
+						t.Errorf("Generated code missing: %s", element)
+					}
+				}
+
+				t.Logf("Generated code:\n%s", generated)
+			},
+		)
+	}
+}
@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// GeneratePatch writes a partial-update type for structDef to outputFile.
+// <Struct>Patch holds every field behind a pointer, nil meaning "leave
+// unchanged", and comes with Apply, IsEmpty and a Diff<Struct> function
+// building the patch that turns one value into another.
+func GeneratePatch(structDef *parser.StructDef, packageName string, outputFile string) error {
+	return writeFile(outputFile, func(w io.Writer) error {
+		return RenderPatch(w, structDef, packageName)
+	})
+}
+
+// RenderPatch writes the source GeneratePatch saves to w.
+func RenderPatch(w io.Writer, structDef *parser.StructDef, packageName string) error {
+	if structDef == nil {
+		return fmt.Errorf("structDef cannot be nil")
+	}
+
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	f, importAliases := newFile(structDef, packageName)
+
+	patchName := structDef.Name + "Patch"
+
+	// Generate patch struct
+	var fields []jen.Code
+	for _, field := range structDef.Fields {
+		statement := jen.Id(field.Name).Op("*").Add(getQualifiedType(field.Type, importAliases))
+		if tag, ok := patchJSONTag(field); ok {
+			statement.Tag(map[string]string{"json": tag})
+		}
+		fields = append(fields, statement)
+	}
+	f.Type().Id(patchName).Struct(fields...)
+
+	generatePatchApply(f, patchName, structDef)
+	generatePatchIsEmpty(f, patchName, structDef)
+	generatePatchDiff(f, patchName, structDef)
+
+	return f.Render(w)
+}
+
+// patchJSONTag carries the field's json tag over to the patch, adding
+// omitempty so unset fields are left out of the encoded patch.
+func patchJSONTag(field parser.StructField) (string, bool) {
+	tag, ok := field.Tags["json"]
+	if !ok || tag == "-" {
+		return tag, ok
+	}
+	for _, option := range strings.Split(tag, ",")[1:] {
+		if option == "omitempty" {
+			return tag, true
+		}
+	}
+	return tag + ",omitempty", true
+}
+
+func generatePatchApply(f *jen.File, patchName string, structDef *parser.StructDef) {
+	body := []jen.Code{
+		jen.If(jen.Id("p").Op("==").Nil()).Block(
+			jen.Return(jen.Qual("errors", "New").Call(
+				jen.Lit(fmt.Sprintf("cannot apply %s to a nil *%s", patchName, structDef.Name)),
+			)),
+		),
+		jen.If(jen.Id("patch").Op("==").Nil()).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Id("patched").Op(":=").Op("*").Id("p"),
+	}
+
+	for _, field := range structDef.Fields {
+		body = append(body, jen.If(jen.Id("patch").Dot(field.Name).Op("!=").Nil()).Block(
+			jen.Id("patched").Dot(field.Name).Op("=").Op("*").Id("patch").Dot(field.Name),
+		))
+	}
+
+	if structDef.Annotations.Validate {
+		body = append(body, generateRequiredChecks(structDef, "patched")...)
+	}
+
+	body = append(body,
+		jen.Op("*").Id("p").Op("=").Id("patched"),
+		jen.Return(jen.Nil()),
+	)
+
+	f.Func().Params(
+		jen.Id("patch").Op("*").Id(patchName),
+	).Id("Apply").Params(
+		jen.Id("p").Op("*").Id(structDef.Name),
+	).Error().Block(body...)
+}
+
+func generatePatchIsEmpty(f *jen.File, patchName string, structDef *parser.StructDef) {
+	empty := jen.Id("patch").Op("==").Nil()
+	for i, field := range structDef.Fields {
+		if i == 0 {
+			empty.Op("||")
+		} else {
+			empty.Op("&&")
+		}
+		empty.Id("patch").Dot(field.Name).Op("==").Nil()
+	}
+
+	f.Func().Params(
+		jen.Id("patch").Op("*").Id(patchName),
+	).Id("IsEmpty").Params().Bool().Block(
+		jen.Return(empty),
+	)
+}
+
+func generatePatchDiff(f *jen.File, patchName string, structDef *parser.StructDef) {
+	body := []jen.Code{
+		jen.Var().Id("patch").Id(patchName),
+		jen.If(jen.Id("old").Op("==").Nil()).Block(
+			jen.Id("old").Op("=").Op("&").Id(structDef.Name).Values(),
+		),
+		jen.If(jen.Id("updated").Op("==").Nil()).Block(
+			jen.Id("updated").Op("=").Op("&").Id(structDef.Name).Values(),
+		),
+	}
+
+	for _, field := range structDef.Fields {
+		name := paramName(field.Name)
+		body = append(body, jen.If(
+			differs(jen.Id("old").Dot(field.Name), jen.Id("updated").Dot(field.Name), field.Type),
+		).Block(
+			jen.Id(name).Op(":=").Id("updated").Dot(field.Name),
+			jen.Id("patch").Dot(field.Name).Op("=").Op("&").Id(name),
+		))
+	}
+	body = append(body, jen.Return(jen.Id("patch")))
+
+	f.Func().Id("Diff" + structDef.Name).Params(
+		jen.List(jen.Id("old"), jen.Id("updated")).Op("*").Id(structDef.Name),
+	).Id(patchName).Block(body...)
+}
+
+// differs returns an expression reporting whether a and b, both of fieldType,
+// hold different values. Basic types are compared directly, anything else
+// through reflect.DeepEqual so pointers and collections compare by content.
+func differs(a, b *jen.Statement, fieldType string) *jen.Statement {
+	if fieldType == "string" || fieldType == "bool" || isNumeric(fieldType) {
+		return a.Op("!=").Add(b)
+	}
+	return jen.Op("!").Qual("reflect", "DeepEqual").Call(a, b)
+}
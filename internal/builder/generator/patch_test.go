@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestGeneratePatch(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "Account",
+		PackageStr: "testmodel",
+		Fields: []parser.StructField{
+			{Name: "Email", Type: "string", Tags: map[string]string{"json": "email", "validate": "required"}},
+			{Name: "Nickname", Type: "*string"},
+			{Name: "Roles", Type: "[]string", Tags: map[string]string{"json": "roles,omitempty"}},
+			{Name: "Created", Type: "time.Time"},
+		},
+		Imports: []string{
+			`"time"`,
+		},
+		Annotations: parser.BuilderAnnotations{
+			Validate: true,
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "account_patch.go")
+
+	if err := GeneratePatch(structDef, "testmodel", outputFile); err != nil {
+		t.Fatalf("GeneratePatch failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	generated := string(content)
+	t.Logf("Generated code:\n%s", generated)
+
+	expected := []string{
+		"type AccountPatch struct",
+		"Email    *string `json:\"email,omitempty\"`",
+		"Nickname **string",
+		"Roles    *[]string `json:\"roles,omitempty\"`",
+		"Created  *time.Time",
+		"func (patch *AccountPatch) Apply(p *Account) error",
+		"patched.Email = *patch.Email",
+		`if patched.Email == "" {`,
+		"*p = patched",
+		"func (patch *AccountPatch) IsEmpty() bool",
+		"return patch == nil || patch.Email == nil && patch.Nickname == nil && patch.Roles == nil && patch.Created == nil",
+		"func DiffAccount(old, updated *Account) AccountPatch",
+		"if old.Email != updated.Email {",
+		"if !reflect.DeepEqual(old.Roles, updated.Roles) {",
+	}
+
+	for _, item := range expected {
+		if !strings.Contains(generated, item) {
+			t.Errorf("Generated code missing: %s", item)
+		}
+	}
+}
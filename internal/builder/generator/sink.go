@@ -0,0 +1,207 @@
+package generator
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives generated files. Implementations decide where they go:
+// DirSink writes them to disk and MemorySink keeps them in memory, so a
+// whole run can be checked or used as an overlay without touching the
+// working tree.
+type Sink interface {
+	WriteFile(name string, content []byte) error
+}
+
+// WriteTo saves the source produced by render to name in sink, leaving the
+// sink untouched when render produces nothing.
+func WriteTo(sink Sink, name string, render func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return sink.WriteFile(name, buf.Bytes())
+}
+
+// DirSink writes files to the operating system file system. Names are
+// slash or OS separated paths relative to Dir, or to the current directory
+// when Dir is empty; absolute names are written as is.
+type DirSink struct {
+	Dir string
+}
+
+// WriteFile writes content to name, creating or truncating it.
+func (s DirSink) WriteFile(name string, content []byte) error {
+	name = filepath.FromSlash(name)
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(s.Dir, name)
+	}
+	return os.WriteFile(name, content, 0o644)
+}
+
+// MemorySink keeps written files in memory by name. It is safe for
+// concurrent use, and its zero value is an empty sink.
+type MemorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// WriteFile records a copy of content as the file name, replacing any
+// earlier content.
+func (s *MemorySink) WriteFile(name string, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[name] = bytes.Clone(content)
+	return nil
+}
+
+// ReadFile returns the content written to name.
+func (s *MemorySink) ReadFile(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.files[name]
+	return bytes.Clone(content), ok
+}
+
+// Names returns the names of the files written, sorted.
+func (s *MemorySink) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// FS returns a snapshot of the files written as an fs.FS, such as an
+// overlay for a later run. Files whose names are not valid fs.FS paths,
+// such as absolute ones, are left out.
+func (s *MemorySink) FS() fs.FS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fsys := make(memoryFS, len(s.files))
+	for name, content := range s.files {
+		if fs.ValidPath(name) {
+			fsys[name] = bytes.Clone(content)
+		}
+	}
+	return fsys
+}
+
+// memoryFS is a read-only fs.FS of file contents by path. Directories are
+// implied by the paths of the files they hold.
+type memoryFS map[string][]byte
+
+// Open opens the file or directory name.
+func (m memoryFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if content, ok := m[name]; ok {
+		info := memoryInfo{name: path.Base(name), size: int64(len(content))}
+		return &memoryFile{info: info, Reader: bytes.NewReader(content)}, nil
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := make(map[string]bool)
+	for file := range m {
+		rest, ok := strings.CutPrefix(file, prefix)
+		if !ok {
+			continue
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		children[child] = children[child] || isDir
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	dir := &memoryDir{info: memoryInfo{name: path.Base(name), dir: true}}
+	for child, isDir := range children {
+		info := memoryInfo{name: child, dir: isDir}
+		if !isDir {
+			info.size = int64(len(m[prefix+child]))
+		}
+		dir.entries = append(dir.entries, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(dir.entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return dir, nil
+}
+
+// memoryFile is an open file of a memoryFS.
+type memoryFile struct {
+	info memoryInfo
+	*bytes.Reader
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memoryFile) Close() error               { return nil }
+
+// memoryDir is an open directory of a memoryFS.
+type memoryDir struct {
+	info    memoryInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memoryDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memoryDir) Close() error               { return nil }
+
+func (d *memoryDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of the directory, or all the
+// remaining ones when n <= 0.
+func (d *memoryDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(n, len(entries))]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
+
+// memoryInfo describes a file or directory of a memoryFS.
+type memoryInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) ModTime() time.Time { return time.Time{} }
+func (i memoryInfo) IsDir() bool        { return i.dir }
+func (i memoryInfo) Sys() any           { return nil }
+
+func (i memoryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestWriteTo(t *testing.T) {
+	structDef := &parser.StructDef{
+		Name:       "Person",
+		PackageStr: "testmodel",
+		Fields:     []parser.StructField{{Name: "Name", Type: "string"}},
+	}
+	render := func(w io.Writer) error {
+		return Render(w, structDef, "testmodel")
+	}
+
+	var sink MemorySink
+	if err := WriteTo(&sink, "model/person_builder.go", render); err != nil {
+		t.Fatal(err)
+	}
+	skipped := &parser.StructDef{Name: "Draft", Annotations: parser.BuilderAnnotations{Skip: true}}
+	err := WriteTo(&sink, "model/draft_builder.go", func(w io.Writer) error {
+		return Render(w, skipped, "testmodel")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTo(&sink, "/abs/person_builder.go", render); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := strings.Join(sink.Names(), " "); names != "/abs/person_builder.go model/person_builder.go" {
+		t.Errorf("Names() = %s, want the files rendering to something", names)
+	}
+	content, ok := sink.ReadFile("model/person_builder.go")
+	if !ok || !strings.Contains(string(content), "func (b *PersonBuilder) WithName(name string) *PersonBuilder") {
+		t.Errorf("ReadFile() = %v:\n%s", ok, content)
+	}
+
+	// The FS is a snapshot of the files with valid paths
+	fsys := sink.FS()
+	fromFS, err := fs.ReadFile(fsys, "model/person_builder.go")
+	if err != nil || string(fromFS) != string(content) {
+		t.Errorf("FS() does not hold the builder: %v", err)
+	}
+	if err := fstest.TestFS(fsys, "model/person_builder.go"); err != nil {
+		t.Error(err)
+	}
+	if err := sink.WriteFile("model/person_builder.go", nil); err != nil {
+		t.Fatal(err)
+	}
+	if fromFS, _ := fs.ReadFile(fsys, "model/person_builder.go"); len(fromFS) == 0 {
+		t.Error("FS() changed with a later write")
+	}
+
+	dir := t.TempDir()
+	if err := WriteTo(DirSink{Dir: dir}, "person_builder.go", render); err != nil {
+		t.Fatal(err)
+	}
+	onDisk, err := os.ReadFile(filepath.Join(dir, "person_builder.go"))
+	if err != nil || string(onDisk) != string(content) {
+		t.Errorf("DirSink did not write the builder: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package loader resolves Go package patterns such as ./... into parsed source
+// files. Loading goes through go/packages, so build tags, GOOS/GOARCH, vendor
+// and testdata directories and nested modules behave as they do for go build.
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type Config struct {
+	Dir  string   // directory patterns are resolved from, the current one if empty
+	Tags []string // build tags, as given to go build -tags
+	Env  []string // environment for the go command, the current one if nil
+}
+
+type File struct {
+	Path   string
+	Syntax *ast.File
+}
+
+type Package struct {
+	Path  string // import path
+	Name  string
+	Dir   string
+	Files []File // non-test files matching the build constraints
+}
+
+// Load returns the packages matching patterns, with every file parsed into
+// fset including comments. Test files are not loaded. Files are parsed from
+// the package directory, cgo files included, rather than from the
+// translation go build compiles.
+func Load(cfg Config, fset *token.FileSet, patterns ...string) ([]*Package, error) {
+	var buildFlags []string
+	if len(cfg.Tags) > 0 {
+		buildFlags = append(buildFlags, "-tags="+strings.Join(cfg.Tags, ","))
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode:       packages.NeedName | packages.NeedFiles,
+		Dir:        cfg.Dir,
+		Env:        cfg.Env,
+		BuildFlags: buildFlags,
+		Fset:       fset,
+	}, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", strings.Join(patterns, " "), err)
+	}
+
+	var errs []string
+	var loaded []*Package
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			errs = append(errs, pkgErr.Error())
+		}
+
+		p := &Package{
+			Path: pkg.PkgPath,
+			Name: pkg.Name,
+		}
+		for _, path := range pkg.GoFiles {
+			syntax, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			p.Files = append(p.Files, File{Path: path, Syntax: syntax})
+		}
+		if len(pkg.GoFiles) > 0 {
+			p.Dir = filepath.Dir(pkg.GoFiles[0])
+		}
+		loaded = append(loaded, p)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("loading %s:\n\t%s", strings.Join(patterns, " "), strings.Join(errs, "\n\t"))
+	}
+	return loaded, nil
+}
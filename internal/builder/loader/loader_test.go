@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":                      "module example.com/app\n\ngo 1.24\n",
+		"model/person.go":             "package model\n\ntype Person struct{}\n",
+		"model/person_test.go":        "package model\n",
+		"model/linux_only.go":         "//go:build linux && special\n\npackage model\n",
+		"model/testdata/fixture.go":   "package fixture\n",
+		"nested/go.mod":               "module example.com/nested\n\ngo 1.24\n",
+		"nested/nested.go":            "package nested\n",
+		"vendor/example.com/x/x.go":   "package x\n",
+		"internal/store/store.go":     "package store\n",
+		"internal/store/store_win.go": "//go:build windows\n\npackage store\n",
+		"native/native.go":            "package native\n\n// #include <stdlib.h>\nimport \"C\"\n\ntype Person struct{}\n",
+	})
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "all_packages",
+			cfg:      Config{Dir: root, Env: append(os.Environ(), "GOOS=linux", "CGO_ENABLED=1", "GOFLAGS=-mod=mod")},
+			patterns: []string{"./..."},
+			want: []string{
+				"internal/store/store.go",
+				"model/person.go",
+				"native/native.go",
+			},
+		},
+		{
+			// Files are those of the package, not their cgo translation
+			name:     "cgo",
+			cfg:      Config{Dir: root, Env: append(os.Environ(), "CGO_ENABLED=1", "GOFLAGS=-mod=mod")},
+			patterns: []string{"./native"},
+			want: []string{
+				"native/native.go",
+			},
+		},
+		{
+			name:     "tags_and_goos",
+			cfg:      Config{Dir: root, Tags: []string{"special"}, Env: append(os.Environ(), "GOOS=linux", "GOFLAGS=-mod=mod")},
+			patterns: []string{"./model"},
+			want: []string{
+				"model/linux_only.go",
+				"model/person.go",
+			},
+		},
+		{
+			name:     "other_goos",
+			cfg:      Config{Dir: root, Env: append(os.Environ(), "GOOS=windows", "GOFLAGS=-mod=mod")},
+			patterns: []string{"example.com/app/internal/store"},
+			want: []string{
+				"internal/store/store.go",
+				"internal/store/store_win.go",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pkgs, err := Load(tt.cfg, token.NewFileSet(), tt.patterns...)
+				if err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+
+				var got []string
+				for _, pkg := range pkgs {
+					for _, file := range pkg.Files {
+						if file.Syntax == nil {
+							t.Errorf("%s was not parsed", file.Path)
+						}
+						rel, err := filepath.Rel(root, file.Path)
+						if err != nil {
+							t.Fatal(err)
+						}
+						got = append(got, filepath.ToSlash(rel))
+					}
+				}
+				sort.Strings(got)
+
+				if len(got) != len(tt.want) {
+					t.Fatalf("loaded %v, want %v", got, tt.want)
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("loaded %v, want %v", got, tt.want)
+						break
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestLoadUnknownPackage(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.24\n",
+	})
+
+	if _, err := Load(Config{Dir: root}, token.NewFileSet(), "./missing"); err == nil {
+		t.Error("expected an error for a missing package")
+	}
+}
@@ -1,205 +1,433 @@
 package parser
 
 import (
-"fmt"
-"go/ast"
-"go/parser"
-"go/token"
-"strings"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"strconv"
+	"strings"
 )
 
+// DefaultPrefix is the setter prefix of structs without @builder:prefix.
+const DefaultPrefix = "With"
+
 type MethodMap struct {
-From string
-To   string
+	From string
+	To   string
 }
 
 type StructField struct {
-Name      string
-Type      string
-Tags      map[string]string
-CustomGen bool // true if this field's setter should not be generated
+	Name      string
+	Type      string
+	Tags      map[string]string
+	CustomGen bool // true if this field's setter should not be generated
+}
+
+// Default returns the value of the field's `default` struct tag.
+func (f StructField) Default() (string, bool) {
+	value, ok := f.Tags["default"]
+	return value, ok
+}
+
+// Required reports whether the field's `validate` struct tag lists "required".
+func (f StructField) Required() bool {
+	for _, rule := range strings.Split(f.Tags["validate"], ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
 }
 
 type BuilderAnnotations struct {
-Prefix      string      // @builder:prefix <value>
-Validate    bool        // @builder:validate
-Skip        bool        // @builder:skip
-Package     string      // @builder:package <value>
-Output      string      // @builder:output <pattern>
-Immutable   bool        // @builder:immutable - generates Copy() instead of setters
-Chain       bool        // @builder:chain - enables method chaining (default true)
-Constructor string      // @builder:constructor <name> - custom constructor name
-MethodMaps  []MethodMap // @builder:map <from>:<to> - maps one method to another
-CustomMethods []string  // @builder:custom <method> - skip generation for these methods
+	Builder       bool        // @builder, implied by @builder:<option> unless another generator is requested
+	Prefix        string      // @builder:prefix <value>, empty for DefaultPrefix when not given
+	Validate      bool        // @builder:validate
+	Skip          bool        // @builder:skip
+	Package       string      // @builder:package <value>
+	Output        string      // @builder:output <pattern>
+	Immutable     bool        // @builder:immutable - generates Copy() instead of setters
+	Chain         bool        // @builder:chain - enables method chaining (default true)
+	Constructor   string      // @builder:constructor <name> - custom constructor name
+	MethodMaps    []MethodMap // @builder:map <from>:<to> - maps one method to another
+	CustomMethods []string    // @builder:custom <method> - skip generation for these methods
+	Enforce       bool        // @builder:enforce - composite literals are reported outside the package
+	Options       bool        // @options - generates functional options instead of a builder
+	Merge         bool        // @merge - generates Merge, WithDefaults and getters for an options struct
+	Patch         bool        // @patch - generates a <Struct>Patch partial-update type
+	Equal         bool        // @equal - generates Equal and Diff methods
+	Clone         bool        // @clone - generates Clone and DeepCopyInto methods
 }
 
 type StructDef struct {
-Name        string
-Fields      []StructField
-PackageStr  string
-Imports     []string
-Annotations BuilderAnnotations
+	Name        string
+	Position    token.Position // where the type is declared
+	Fields      []StructField
+	Embedded    []StructField // embedded fields, named after their type
+	PackageStr  string
+	Imports     []string
+	Annotations BuilderAnnotations
+	// Siblings holds the annotations of the other annotated structs declared
+	// alongside this one, so generators can call the methods generated for
+	// them. ParseStructs sets those of the file, ShareSiblings those of the
+	// package.
+	Siblings map[string]BuilderAnnotations
+	// BuildConstraint is the expression of the //go:build line of the file
+	// declaring the struct, empty when it has none.
+	BuildConstraint string
+}
+
+// SetPrefix changes the setter prefix of s, updating which fields have
+// their setters implemented by hand through @builder:custom.
+func (s *StructDef) SetPrefix(prefix string) {
+	s.Annotations.Prefix = prefix
+	for i := range s.Fields {
+		s.Fields[i].CustomGen = isCustomMethod(s.Fields[i].Name, prefix, s.Annotations.CustomMethods)
+	}
 }
 
 // normalizeMethodName ensures consistent method name format for comparison
 func normalizeMethodName(name string, prefix string) string {
-name = strings.ToLower(name)
-prefix = strings.ToLower(prefix)
-if strings.HasPrefix(name, strings.ToLower(prefix)) {
-return name
-}
-return prefix + name
+	name = strings.ToLower(name)
+	prefix = strings.ToLower(prefix)
+	if strings.HasPrefix(name, strings.ToLower(prefix)) {
+		return name
+	}
+	return prefix + name
 }
 
 // isCustomMethod checks if a method should be custom implemented
 func isCustomMethod(fieldName string, prefix string, customMethods []string) bool {
-normalizedFieldMethod := normalizeMethodName(fieldName, prefix)
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	normalizedFieldMethod := normalizeMethodName(fieldName, prefix)
 
-for _, custom := range customMethods {
-normalizedCustom := normalizeMethodName(custom, prefix)
-if normalizedFieldMethod == normalizedCustom {
-return true
-}
-}
+	for _, custom := range customMethods {
+		normalizedCustom := normalizeMethodName(custom, prefix)
+		if normalizedFieldMethod == normalizedCustom {
+			return true
+		}
+	}
 
-return false
+	return false
 }
 
+// ParseFile parses filename and returns the definition of the struct type
+// named typeName, or of the first struct type when typeName is empty. The
+// struct does not need to carry any annotation.
 func ParseFile(filename string, typeName string) (*StructDef, error) {
-fset := token.NewFileSet()
-node, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
-if err != nil {
-return nil, err
-}
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
 
-var structDef StructDef
-structDef.PackageStr = node.Name.Name
+	for _, structDef := range ParseStructs(fset, node) {
+		if typeName == "" || structDef.Name == typeName {
+			return structDef, nil
+		}
+	}
 
-// Collect imports
-for _, imp := range node.Imports {
-structDef.Imports = append(structDef.Imports, imp.Path.Value)
+	if typeName == "" {
+		return nil, fmt.Errorf("no struct type found in %s", filename)
+	}
+	return nil, fmt.Errorf("struct type %s not found in %s", typeName, filename)
 }
 
-ast.Inspect(
-node, func(n ast.Node) bool {
-switch x := n.(type) {
-case *ast.TypeSpec:
-if s, ok := x.Type.(*ast.StructType); ok {
-if typeName != "" && x.Name.Name != typeName {
-return true
-}
-structDef.Name = x.Name.Name
+// ParseStructs returns the definition of every struct type declared in file,
+// annotated or not, in declaration order. Positions are resolved through
+// fset, the file set file was parsed with.
+func ParseStructs(fset *token.FileSet, file *ast.File) []*StructDef {
+	var imports []string
+	for _, imp := range file.Imports {
+		imports = append(imports, imp.Path.Value)
+	}
 
-// Parse struct annotations from doc comments
-if x.Doc != nil {
-structDef.Annotations = ParseAnnotations(x.Doc)
-}
+	siblings := CollectAnnotations(file)
+	buildConstraint := BuildConstraint(file)
 
-// Ensure we have a prefix
-if structDef.Annotations.Prefix == "" {
-structDef.Annotations.Prefix = "With"
+	var structDefs []*StructDef
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			s, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			annotations := ParseAnnotations(typeDoc(genDecl, typeSpec))
+			structDefs = append(structDefs, &StructDef{
+				Name:        typeSpec.Name.Name,
+				Position:    fset.Position(typeSpec.Pos()),
+				Fields:      ParseFields(s, annotations),
+				Embedded:    ParseEmbedded(s),
+				PackageStr:  file.Name.Name,
+				Imports:     imports,
+				Annotations: annotations,
+				Siblings:    siblings,
+				// Set by the file, like the imports
+				BuildConstraint: buildConstraint,
+			})
+		}
+	}
+	return structDefs
 }
 
-// Process fields
-for _, field := range s.Fields.List {
-if len(field.Names) > 0 {
-fieldName := field.Names[0].Name
-structField := StructField{
-Name: fieldName,
-Type: typeToString(field.Type),
-Tags: parseTags(field.Tag),
-CustomGen: isCustomMethod(fieldName, structDef.Annotations.Prefix, structDef.Annotations.CustomMethods),
+// BuildConstraint returns the expression of the //go:build line of file,
+// or an empty string when it has none.
+func BuildConstraint(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			if expr, err := constraint.Parse(comment.Text); err == nil {
+				return expr.String()
+			}
+		}
+	}
+	return ""
 }
-structDef.Fields = append(structDef.Fields, structField)
+
+// typeDoc returns the doc comment of a type, which the parser attaches to the
+// enclosing declaration unless the type is part of a grouped declaration.
+func typeDoc(genDecl *ast.GenDecl, typeSpec *ast.TypeSpec) *ast.CommentGroup {
+	if typeSpec.Doc != nil {
+		return typeSpec.Doc
+	}
+	return genDecl.Doc
 }
+
+// ParseFields extracts the named fields of a struct type, marking the ones
+// whose setters are implemented by hand through @builder:custom.
+func ParseFields(s *ast.StructType, annotations BuilderAnnotations) []StructField {
+	var fields []StructField
+	for _, field := range s.Fields.List {
+		for _, name := range field.Names {
+			fields = append(fields, StructField{
+				Name:      name.Name,
+				Type:      typeToString(field.Type),
+				Tags:      parseTags(field.Tag),
+				CustomGen: isCustomMethod(name.Name, annotations.Prefix, annotations.CustomMethods),
+			})
+		}
+	}
+	return fields
 }
-return false
+
+// CollectAnnotations returns the annotations of every documented struct type
+// declared in file, keyed by type name.
+func CollectAnnotations(file *ast.File) map[string]BuilderAnnotations {
+	annotations := make(map[string]BuilderAnnotations)
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			doc := typeDoc(genDecl, typeSpec)
+			if _, ok := typeSpec.Type.(*ast.StructType); ok && doc != nil {
+				annotations[typeSpec.Name.Name] = ParseAnnotations(doc)
+			}
+		}
+	}
+	return annotations
 }
+
+// ShareSiblings sets the siblings of each of structDefs, the structs of one
+// package, to the annotated structs of every file, so the methods generated
+// for a struct declared in another file are called too.
+func ShareSiblings(structDefs []*StructDef) {
+	siblings := make(map[string]BuilderAnnotations)
+	for _, structDef := range structDefs {
+		maps.Copy(siblings, structDef.Siblings)
+	}
+	for _, structDef := range structDefs {
+		structDef.Siblings = siblings
+	}
 }
-return true
-},
-)
 
-return &structDef, nil
+// ParseEmbedded extracts the embedded fields of a struct type. Each field is
+// named after its type, as Go does when selecting it.
+func ParseEmbedded(s *ast.StructType) []StructField {
+	var fields []StructField
+	for _, field := range s.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+
+		name := field.Type
+		if star, ok := name.(*ast.StarExpr); ok {
+			name = star.X
+		}
+		if sel, ok := name.(*ast.SelectorExpr); ok {
+			name = sel.Sel
+		}
+		ident, ok := name.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, StructField{
+			Name: ident.Name,
+			Type: typeToString(field.Type),
+			Tags: parseTags(field.Tag),
+		})
+	}
+	return fields
 }
 
 func typeToString(expr ast.Expr) string {
-switch t := expr.(type) {
-case *ast.Ident:
-return t.Name
-case *ast.StarExpr:
-return "*" + typeToString(t.X)
-case *ast.SelectorExpr:
-return fmt.Sprintf("%s.%s", typeToString(t.X), t.Sel.Name)
-case *ast.ArrayType:
-return "[]" + typeToString(t.Elt)
-default:
-return fmt.Sprintf("%v", expr)
-}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + typeToString(t.X)
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s", typeToString(t.X), t.Sel.Name)
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "[]" + typeToString(t.Elt)
+		}
+		return types.ExprString(t)
+	default:
+		return types.ExprString(expr)
+	}
 }
 
+// parseTags splits a raw struct tag into its key/value pairs, following the
+// conventional `key:"value"` syntax understood by reflect.StructTag.
 func parseTags(tag *ast.BasicLit) map[string]string {
-tags := make(map[string]string)
-if tag == nil {
-return tags
-}
-return tags
+	tags := make(map[string]string)
+	if tag == nil {
+		return tags
+	}
+
+	raw, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		return tags
+	}
+
+	for {
+		raw = strings.TrimLeft(raw, " ")
+		i := strings.Index(raw, ":")
+		if i <= 0 {
+			break
+		}
+		key := raw[:i]
+		quoted, err := strconv.QuotedPrefix(raw[i+1:])
+		if err != nil {
+			break
+		}
+		raw = raw[i+1+len(quoted):]
+		if value, err := strconv.Unquote(quoted); err == nil {
+			tags[key] = value
+		}
+	}
+	return tags
 }
 
 // ParseAnnotations extracts builder annotations from doc comments
 func ParseAnnotations(comments *ast.CommentGroup) BuilderAnnotations {
-annotations := BuilderAnnotations{
-Prefix: "With",
-Chain:  true,
-}
-
-if comments == nil {
-return annotations
-}
-
-for _, comment := range comments.List {
-text := strings.TrimPrefix(comment.Text, "//")
-text = strings.TrimSpace(text)
-
-switch {
-case strings.HasPrefix(text, "@builder:prefix"):
-value := strings.TrimPrefix(text, "@builder:prefix")
-annotations.Prefix = strings.TrimSpace(value)
-case strings.HasPrefix(text, "@builder:validate"):
-annotations.Validate = true
-case strings.HasPrefix(text, "@builder:skip"):
-annotations.Skip = true
-case strings.HasPrefix(text, "@builder:package"):
-value := strings.TrimPrefix(text, "@builder:package")
-annotations.Package = strings.TrimSpace(value)
-case strings.HasPrefix(text, "@builder:output"):
-value := strings.TrimPrefix(text, "@builder:output")
-annotations.Output = strings.TrimSpace(value)
-case strings.HasPrefix(text, "@builder:immutable"):
-annotations.Immutable = true
-case strings.HasPrefix(text, "@builder:nochain"):
-annotations.Chain = false
-case strings.HasPrefix(text, "@builder:constructor"):
-value := strings.TrimPrefix(text, "@builder:constructor")
-annotations.Constructor = strings.TrimSpace(value)
-case strings.HasPrefix(text, "@builder:map"):
-value := strings.TrimPrefix(text, "@builder:map")
-value = strings.TrimSpace(value)
-parts := strings.Split(value, ":")
-if len(parts) == 2 {
-annotations.MethodMaps = append(annotations.MethodMaps, MethodMap{
-From: strings.TrimSpace(parts[0]),
-To:   strings.TrimSpace(parts[1]),
-})
-}
-case strings.HasPrefix(text, "@builder:custom"):
-value := strings.TrimPrefix(text, "@builder:custom")
-method := strings.TrimSpace(value)
-annotations.CustomMethods = append(annotations.CustomMethods, method)
-case text == "@builder":
-// Base annotation, already handled
-}
-}
-
-return annotations
+	annotations := BuilderAnnotations{
+		Chain: true,
+	}
+
+	if comments == nil {
+		return annotations
+	}
+
+	builderOption := false
+	for _, comment := range comments.List {
+		text := strings.TrimPrefix(comment.Text, "//")
+		text = strings.TrimSpace(text)
+
+		if strings.HasPrefix(text, "@builder:") {
+			builderOption = true
+		}
+
+		switch {
+		case strings.HasPrefix(text, "@builder:prefix"):
+			value := strings.TrimPrefix(text, "@builder:prefix")
+			annotations.Prefix = strings.TrimSpace(value)
+		case strings.HasPrefix(text, "@builder:validate"):
+			annotations.Validate = true
+		case strings.HasPrefix(text, "@builder:skip"):
+			annotations.Skip = true
+		case strings.HasPrefix(text, "@builder:package"):
+			value := strings.TrimPrefix(text, "@builder:package")
+			annotations.Package = strings.TrimSpace(value)
+		case strings.HasPrefix(text, "@builder:output"):
+			value := strings.TrimPrefix(text, "@builder:output")
+			annotations.Output = strings.TrimSpace(value)
+		case strings.HasPrefix(text, "@builder:immutable"):
+			annotations.Immutable = true
+		case strings.HasPrefix(text, "@builder:nochain"):
+			annotations.Chain = false
+		case strings.HasPrefix(text, "@builder:constructor"):
+			value := strings.TrimPrefix(text, "@builder:constructor")
+			annotations.Constructor = strings.TrimSpace(value)
+		case strings.HasPrefix(text, "@builder:map"):
+			value := strings.TrimPrefix(text, "@builder:map")
+			value = strings.TrimSpace(value)
+			parts := strings.Split(value, ":")
+			if len(parts) == 2 {
+				annotations.MethodMaps = append(annotations.MethodMaps, MethodMap{
+					From: strings.TrimSpace(parts[0]),
+					To:   strings.TrimSpace(parts[1]),
+				})
+			}
+		case strings.HasPrefix(text, "@builder:enforce"):
+			annotations.Enforce = true
+		case strings.HasPrefix(text, "@builder:custom"):
+			value := strings.TrimPrefix(text, "@builder:custom")
+			method := strings.TrimSpace(value)
+			annotations.CustomMethods = append(annotations.CustomMethods, method)
+		case text == "@builder":
+			annotations.Builder = true
+		case text == "@options":
+			annotations.Options = true
+		case text == "@merge":
+			annotations.Merge = true
+		case text == "@patch":
+			annotations.Patch = true
+		case text == "@equal":
+			annotations.Equal = true
+		case text == "@clone":
+			annotations.Clone = true
+		}
+	}
+
+	// Builder options on their own still ask for a builder, as they always
+	// did; next to another generator marker they only configure that one
+	if builderOption && !annotations.HasCompanion() {
+		annotations.Builder = true
+	}
+
+	return annotations
+}
+
+// HasCompanion reports whether a generator other than the builder is
+// requested.
+func (a BuilderAnnotations) HasCompanion() bool {
+	return a.Options || a.Merge || a.Patch || a.Equal || a.Clone
 }
@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const source = `package model
+
+import "time"
+
+// Person is annotated on the declaration, as gofmt lays it out.
+// @builder
+// @builder:prefix Set
+type Person struct {
+	Name      string ` + "`json:\"name\" default:\"anon\" validate:\"required\"`" + `
+	Born      time.Time
+	Tags      map[string][]string
+	Nick, Alt string
+	*Base
+}
+
+// @options
+// @builder:validate
+type Server struct {
+	Host string
+}
+
+type Base struct{}
+`
+
+func writeSource(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "model.go")
+	if err := os.WriteFile(filename, []byte(source), 0o644); err != nil {
+		t.Fatalf("writing source: %v", err)
+	}
+	return filename
+}
+
+func TestParseFile(t *testing.T) {
+	filename := writeSource(t)
+
+	structDef, err := ParseFile(filename, "Person")
+	if err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+
+	if pos := structDef.Position; pos.Filename != filename || pos.Line != 8 || pos.Column != 6 {
+		t.Errorf("Position = %v, want %s:8:6", pos, filename)
+	}
+
+	if !structDef.Annotations.Builder || structDef.Annotations.Prefix != "Set" {
+		t.Errorf("annotations not read from the declaration doc: %+v", structDef.Annotations)
+	}
+
+	wantTypes := map[string]string{
+		"Name": "string",
+		"Born": "time.Time",
+		"Tags": "map[string][]string",
+		"Nick": "string",
+		"Alt":  "string",
+	}
+	if len(structDef.Fields) != len(wantTypes) {
+		t.Fatalf("got %d fields, want %d", len(structDef.Fields), len(wantTypes))
+	}
+	for _, field := range structDef.Fields {
+		if wantTypes[field.Name] != field.Type {
+			t.Errorf("field %s has type %q, want %q", field.Name, field.Type, wantTypes[field.Name])
+		}
+	}
+
+	name := structDef.Fields[0]
+	if name.Tags["json"] != "name" {
+		t.Errorf("json tag = %q, want %q", name.Tags["json"], "name")
+	}
+	if value, ok := name.Default(); !ok || value != "anon" {
+		t.Errorf("Default() = %q, %v", value, ok)
+	}
+	if !name.Required() {
+		t.Error("Required() = false, want true")
+	}
+
+	if len(structDef.Embedded) != 1 || structDef.Embedded[0].Name != "Base" || structDef.Embedded[0].Type != "*Base" {
+		t.Errorf("unexpected embedded fields: %+v", structDef.Embedded)
+	}
+
+	if !structDef.Siblings["Server"].Options {
+		t.Error("Siblings should carry the annotations of Server")
+	}
+}
+
+func TestShareSiblings(t *testing.T) {
+	address := &StructDef{Name: "Address", Siblings: map[string]BuilderAnnotations{"Address": {Clone: true}}}
+	person := &StructDef{Name: "Person", Siblings: map[string]BuilderAnnotations{"Person": {Clone: true, Equal: true}}}
+
+	ShareSiblings([]*StructDef{address, person})
+	for _, structDef := range []*StructDef{address, person} {
+		if !structDef.Siblings["Address"].Clone || !structDef.Siblings["Person"].Equal {
+			t.Errorf("%s has siblings %+v, want those of both files", structDef.Name, structDef.Siblings)
+		}
+	}
+}
+
+func TestParseFileTypeNotFound(t *testing.T) {
+	if _, err := ParseFile(writeSource(t), "Missing"); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestParseStructsBuilderMarker(t *testing.T) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "model.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	structDefs := ParseStructs(fset, node)
+	if len(structDefs) != 3 {
+		t.Fatalf("got %d structs, want 3", len(structDefs))
+	}
+
+	// @builder:validate configures the options, it does not ask for a builder
+	server := structDefs[1]
+	if server.Annotations.Builder || !server.Annotations.Options {
+		t.Errorf("Server: %+v", server.Annotations)
+	}
+
+	base := structDefs[2]
+	if base.Annotations.Builder || base.Annotations.HasCompanion() {
+		t.Errorf("Base should not request any generator: %+v", base.Annotations)
+	}
+}
+
+func TestBuildConstraint(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "none", src: "package model\n", want: ""},
+		{name: "go:build", src: "// Copyright\n\n//go:build linux && !arm\n\npackage model\n", want: "linux && !arm"},
+		{name: "after package clause", src: "package model\n\n//go:build linux\n", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parser.ParseFile(token.NewFileSet(), "model.go", tt.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := BuildConstraint(node); got != tt.want {
+				t.Errorf("BuildConstraint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
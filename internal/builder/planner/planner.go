@@ -0,0 +1,588 @@
+// Package planner plans the files generated for annotated structs once
+// their settings are resolved, and renders them. The generator commands and
+// the builder package share it, so they write the same files.
+package planner
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+// Generation modes for structs annotated with @builder.
+const (
+	ModeBuilder = "builder"
+	ModeOptions = "options"
+)
+
+// Settings are the resolved settings a struct is planned with.
+type Settings struct {
+	Prefix string
+	// Output is the builder file pattern, where {name} stands for the
+	// lower-cased struct name
+	Output string
+	// Package overrides the package of generated files
+	Package  string
+	Validate bool
+	// Mode is what to generate for @builder structs: ModeBuilder or
+	// ModeOptions
+	Mode string
+	// Preamble is the header and build constraint of the generated files.
+	// Without a build constraint, the files generated for the struct get
+	// the constraint of its source file.
+	Preamble Preamble
+	// Extensions holds the extension templates by generator name
+	Extensions map[string]Extensions
+}
+
+// Preamble is the custom header and build constraint of a generated file,
+// inserted after the generated code header.
+type Preamble struct {
+	// Header is the template of the custom header, nil for none, parsed
+	// from HeaderSource
+	Header       *template.Template
+	HeaderSource string
+	// BuildConstraint is the expression of the //go:build line
+	BuildConstraint string
+	// Flags are the command line flags the settings were given by,
+	// recorded in the header so the file can be planned again with them
+	Flags []string
+}
+
+// NewPreamble parses the header template source, named name, and
+// normalises the build constraint expr. Both may be empty.
+func NewPreamble(name string, source string, expr string) (Preamble, error) {
+	var pre Preamble
+	if source != "" {
+		header, err := template.New(name).Parse(source)
+		if err != nil {
+			return Preamble{}, fmt.Errorf("parsing header: %w", err)
+		}
+		pre.Header, pre.HeaderSource = header, source
+	}
+	if expr != "" {
+		parsed, err := constraint.Parse("//go:build " + expr)
+		if err != nil {
+			return Preamble{}, fmt.Errorf("build constraint %q: %w", expr, err)
+		}
+		pre.BuildConstraint = parsed.String()
+	}
+	return pre, nil
+}
+
+// Extensions are the extension templates of a generator.
+type Extensions struct {
+	// Dir names where the templates were read from, empty for none
+	Dir       string
+	Templates []*template.Template
+	// Sources holds the name and content of each template, in order
+	Sources []string
+}
+
+// ReadExtensions parses the .tmpl files of the name directory of
+// templates, in file name order. Dir is set to dir.
+func ReadExtensions(templates fs.FS, name string, dir string) (Extensions, error) {
+	paths, err := fs.Glob(templates, name+"/*.tmpl")
+	if err != nil {
+		return Extensions{}, err
+	}
+	extensions := Extensions{Dir: dir}
+	for _, p := range paths {
+		source, err := fs.ReadFile(templates, p)
+		if err != nil {
+			return Extensions{}, fmt.Errorf("reading templates: %w", err)
+		}
+		tmpl, err := generator.ParseExtension(path.Base(p), string(source))
+		if err != nil {
+			return Extensions{}, fmt.Errorf("parsing templates: %w", err)
+		}
+		extensions.Templates = append(extensions.Templates, tmpl)
+		extensions.Sources = append(extensions.Sources, path.Base(p), string(source))
+	}
+	return extensions, nil
+}
+
+// File is a file to generate for one or more structs.
+type File struct {
+	Path string
+	// Generator is the name of the generator, such as builder or equal
+	Generator string
+	// What names the generator in messages: builder, the marker of a
+	// companion or the name of a support file
+	What string
+	// Reason tells what asked for the file
+	Reason string
+	// StructDefs are the structs the file is generated for; support files
+	// keep the struct they were planned for
+	StructDefs  []*parser.StructDef
+	PackageName string
+	Preamble    Preamble
+	// Extensions are applied to the rendered file
+	Extensions Extensions
+	// Support is set for the files shared by the structs of a directory
+	Support bool
+	// Inputs are everything the file is rendered from, hashed to tell
+	// whether an existing file is up to date
+	Inputs []any
+	render func(w io.Writer) error
+}
+
+// Types returns the names of the structs file is generated for, none for
+// support files.
+func (file *File) Types() []string {
+	if file.Support {
+		return nil
+	}
+	var types []string
+	for _, structDef := range file.StructDefs {
+		types = append(types, structDef.Name)
+	}
+	return types
+}
+
+// InputHash returns the hash of the inputs of file, recorded in its header.
+func (file *File) InputHash() (string, error) {
+	return generator.InputHash(file.Inputs...)
+}
+
+// Render returns the source of file, nil when it renders to nothing, as
+// for structs annotated with @builder:skip.
+func (file *File) Render() ([]byte, error) {
+	hash, err := file.InputHash()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := file.render(&buf); err != nil {
+		return nil, err
+	}
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	content := buf.Bytes()
+	if len(file.Extensions.Templates) > 0 {
+		content, err = generator.Extend(content, file.Extensions.Templates, file.extensionData())
+		if err != nil {
+			return nil, err
+		}
+	}
+	content = generator.StampInputHash(content, hash)
+	content = generator.StampFlags(content, file.Preamble.Flags)
+	if pre := file.Preamble; pre.Header != nil || pre.BuildConstraint != "" {
+		comment, err := file.headerComment(hash)
+		if err != nil {
+			return nil, err
+		}
+		content = generator.InsertPreamble(content, comment, pre.BuildConstraint)
+	}
+	return content, nil
+}
+
+// extensionData returns the data the extensions of file are executed with,
+// one for each struct whose code it holds, by struct name as the builders
+// of a shared file are.
+func (file *File) extensionData() []generator.ExtensionData {
+	var data []generator.ExtensionData
+	for _, structDef := range file.StructDefs {
+		if structDef.Annotations.Skip {
+			continue
+		}
+		data = append(data, generator.ExtensionData{
+			Struct:    structDef,
+			Generator: file.Generator,
+			Package:   file.PackageName,
+		})
+	}
+	slices.SortStableFunc(data, func(a, b generator.ExtensionData) int {
+		return strings.Compare(a.Struct.Name, b.Struct.Name)
+	})
+	return data
+}
+
+// headerComment executes the header template of file, generated with the
+// input hash.
+func (file *File) headerComment(hash string) (string, error) {
+	if file.Preamble.Header == nil {
+		return "", nil
+	}
+
+	data := generator.HeaderData{
+		Version:   generator.Version,
+		Generator: file.Generator,
+		InputHash: hash,
+	}
+	// Support files are not generated for any struct in particular
+	if !file.Support {
+		var sources []string
+		for _, structDef := range file.StructDefs {
+			if source := filepath.Base(structDef.Position.Filename); !slices.Contains(sources, source) {
+				sources = append(sources, source)
+			}
+		}
+		data.Types = strings.Join(file.Types(), ", ")
+		data.Sources = strings.Join(sources, ", ")
+	}
+
+	var comment strings.Builder
+	if err := file.Preamble.Header.Execute(&comment, data); err != nil {
+		return "", fmt.Errorf("executing header: %w", err)
+	}
+	return comment.String(), nil
+}
+
+// Planner plans the files of the structs of a run, in the order they are
+// planned. Its zero value plans every generator and stops at the first
+// failure, with paths resolved by OutputPath.
+type Planner struct {
+	// Path returns the path of the output file name of a struct declared
+	// in dir, OutputPath when nil
+	Path func(dir string, name string) (string, error)
+	// Selected reports whether the generator name runs, all when nil
+	Selected func(name string) bool
+	// Fail reports that planning what for structDef failed with err.
+	// Planning goes on with the next file when it returns nil. When Fail
+	// is nil, the error is returned.
+	Fail func(structDef *parser.StructDef, what string, err error) error
+
+	// Files are the planned files, in plan order
+	Files  []*File
+	byPath map[string]*File
+	// optionFuncs records the struct each planned option func is
+	// generated for, by directory and func name
+	optionFuncs map[[2]string]*parser.StructDef
+}
+
+// OutputPath resolves name against dir unless it is absolute.
+func OutputPath(dir string, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// File returns the file planned at path, nil when there is none.
+func (p *Planner) File(path string) *File {
+	return p.byPath[path]
+}
+
+// PlanStruct plans the builder and companion files requested by the
+// annotations of structDef, declared in dir, with settings s applied to
+// it. reason tells what asked for its builder, "@builder on <name>" when
+// empty. It returns the files planned for the struct, including the
+// builder files it shares. The error is the one Fail returns.
+func (p *Planner) PlanStruct(structDef *parser.StructDef, dir string, s Settings, reason string) ([]*File, error) {
+	annotations := structDef.Annotations
+	if !annotations.Builder && !annotations.HasCompanion() {
+		return nil, nil
+	}
+
+	structDef.SetPrefix(s.Prefix)
+	structDef.Annotations.Validate = s.Validate
+
+	// Reasons record what asked for each file, as listed by -dry-run
+	if reason == "" {
+		reason = "@builder on " + structDef.Name
+	}
+	optionsReason := "@options on " + structDef.Name
+
+	// Mode options turns builders into functional options
+	if annotations.Builder && s.Mode == ModeOptions {
+		structDef.Annotations.Builder = false
+		structDef.Annotations.Options = true
+		if !annotations.Options {
+			optionsReason = reason + " with mode options"
+		}
+	}
+
+	packageName := structDef.PackageStr
+	if s.Package != "" {
+		packageName = s.Package
+		structDef.Annotations.Package = s.Package
+	}
+
+	// Files get the build constraint of their source unless one is set,
+	// except the support files shared by the structs of a directory
+	structPreamble := s.Preamble
+	if structPreamble.BuildConstraint == "" {
+		structPreamble.BuildConstraint = structDef.BuildConstraint
+	}
+
+	var files []*File
+	if structDef.Annotations.Builder && p.selected("builder") {
+		file, err := p.planBuilder(structDef, dir, s, reason, packageName, structPreamble)
+		if err != nil {
+			return files, err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+
+	for _, c := range generator.Companions {
+		if !c.Enabled(structDef.Annotations) || !p.selected(c.Name()) {
+			continue
+		}
+		reason := c.Marker + " on " + structDef.Name
+		if c.Marker == "@options" {
+			reason = optionsReason
+			if err := p.checkOptionFuncs(structDef, dir); err != nil {
+				if err := p.fail(structDef, c.Marker, err); err != nil {
+					return files, err
+				}
+				continue
+			}
+		}
+		file, err := p.plan(dir, outputName(c.OutputPattern, structDef.Name), &File{
+			Generator:  c.Name(),
+			What:       c.Marker,
+			Reason:     reason,
+			StructDefs: []*parser.StructDef{structDef},
+			Preamble:   structPreamble,
+			Extensions: s.Extensions[c.Name()],
+			Inputs:     structInputs(c.Marker, packageName, structDef),
+			render: func(w io.Writer) error {
+				return c.Render(w, structDef, packageName)
+			},
+			PackageName: packageName,
+		})
+		if err != nil {
+			return files, err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+
+		if c.Support == nil || annotations.Skip {
+			continue
+		}
+		supportPath, err := p.path(dir, c.SupportFile)
+		if err == nil && p.byPath[supportPath] != nil && p.byPath[supportPath].Support {
+			continue
+		}
+		file, err = p.plan(dir, c.SupportFile, &File{
+			Generator:  c.Name(),
+			What:       c.SupportFile,
+			Reason:     "shared by " + c.Marker + " structs",
+			StructDefs: []*parser.StructDef{structDef},
+			Preamble:   s.Preamble,
+			Inputs:     []any{c.SupportFile, packageName},
+			render: func(w io.Writer) error {
+				return c.Support(w, packageName)
+			},
+			PackageName: packageName,
+			Support:     true,
+		})
+		if err != nil {
+			return files, err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// planBuilder adds the builder of structDef to its file. Builders whose
+// output settings resolve to the same path, such as a per-package
+// zz_generated_builders.go, share a single file. It returns nil when the
+// builder could not be planned and Fail went on.
+func (p *Planner) planBuilder(
+	structDef *parser.StructDef,
+	dir string,
+	s Settings,
+	reason string,
+	packageName string,
+	pre Preamble,
+) (*File, error) {
+	name := outputName(s.Output, structDef.Name)
+	filePath, err := p.path(dir, name)
+	if err != nil {
+		return nil, p.fail(structDef, "builder", err)
+	}
+	inputs := structInputs("builder", packageName, structDef)
+	extensions := s.Extensions["builder"]
+
+	file, ok := p.byPath[filePath]
+	if !ok || file.Generator != "builder" {
+		file = &File{
+			Generator:   "builder",
+			What:        "builder",
+			Reason:      reason,
+			StructDefs:  []*parser.StructDef{structDef},
+			PackageName: packageName,
+			Preamble:    pre,
+			Extensions:  extensions,
+			Inputs:      inputs,
+		}
+		file.render = func(w io.Writer) error {
+			return generator.RenderBuilders(w, file.StructDefs, file.PackageName)
+		}
+		return p.plan(dir, name, file)
+	}
+
+	first := file.StructDefs[0].Name
+	switch {
+	case packageName != file.PackageName:
+		err = fmt.Errorf("%s is generated in package %s for %s, not %s", filePath, file.PackageName, first, packageName)
+	case pre.BuildConstraint != file.Preamble.BuildConstraint:
+		err = fmt.Errorf("%s is generated with build constraint %q for %s, not %q",
+			filePath, file.Preamble.BuildConstraint, first, pre.BuildConstraint)
+	case pre.HeaderSource != file.Preamble.HeaderSource:
+		err = fmt.Errorf("%s is generated with another header for %s", filePath, first)
+	case extensions.Dir != file.Extensions.Dir:
+		err = fmt.Errorf("%s is generated with other templates for %s", filePath, first)
+	}
+	if err != nil {
+		return nil, p.fail(structDef, "builder", err)
+	}
+	file.StructDefs = append(file.StructDefs, structDef)
+	file.Reason += ", " + reason
+	file.Inputs = append(file.Inputs, inputs...)
+	return file, nil
+}
+
+// plan adds file, named name in dir, to the files to generate. Only
+// builders can share a file, through planBuilder; planning another file at
+// the same path fails. It returns nil when file could not be planned and
+// Fail went on.
+func (p *Planner) plan(dir string, name string, file *File) (*File, error) {
+	structDef := file.StructDefs[0]
+	filePath, err := p.path(dir, name)
+	if err != nil {
+		return nil, p.fail(structDef, file.What, err)
+	}
+	if other, ok := p.byPath[filePath]; ok {
+		return nil, p.fail(structDef, file.What, fmt.Errorf("%s is also generated by %s for %s",
+			filePath, other.What, other.StructDefs[0].Name))
+	}
+
+	file.Path = filePath
+	if pre := file.Preamble; pre.HeaderSource != "" || pre.BuildConstraint != "" {
+		file.Inputs = append(file.Inputs, pre.HeaderSource, pre.BuildConstraint)
+	}
+	if flags := file.Preamble.Flags; len(flags) > 0 {
+		file.Inputs = append(file.Inputs, flags)
+	}
+	if sources := file.Extensions.Sources; len(sources) > 0 {
+		file.Inputs = append(file.Inputs, sources)
+	}
+	if p.byPath == nil {
+		p.byPath = make(map[string]*File)
+	}
+	p.byPath[filePath] = file
+	p.Files = append(p.Files, file)
+	return file, nil
+}
+
+// checkOptionFuncs fails when an option func of structDef is already
+// generated for another struct of dir: the funcs of the @options structs
+// of a package share its scope.
+func (p *Planner) checkOptionFuncs(structDef *parser.StructDef, dir string) error {
+	if structDef.Annotations.Skip {
+		return nil
+	}
+
+	var keys [][2]string
+	for _, field := range structDef.Fields {
+		if field.CustomGen {
+			continue
+		}
+		key := [2]string{dir, generator.OptionFuncName(structDef, field)}
+		if other, ok := p.optionFuncs[key]; ok {
+			return fmt.Errorf("option %s is also generated for %s at %s: set @builder:prefix on either struct",
+				key[1], other.Name, other.Position)
+		}
+		keys = append(keys, key)
+	}
+
+	if p.optionFuncs == nil {
+		p.optionFuncs = make(map[[2]string]*parser.StructDef)
+	}
+	for _, key := range keys {
+		p.optionFuncs[key] = structDef
+	}
+	return nil
+}
+
+// selected reports whether the generator name runs.
+func (p *Planner) selected(name string) bool {
+	return p.Selected == nil || p.Selected(name)
+}
+
+// path returns the path of the output file name in dir.
+func (p *Planner) path(dir string, name string) (string, error) {
+	if p.Path == nil {
+		return OutputPath(dir, name)
+	}
+	return p.Path(dir, name)
+}
+
+// fail reports that planning what for structDef failed with err.
+func (p *Planner) fail(structDef *parser.StructDef, what string, err error) error {
+	if p.Fail == nil {
+		return err
+	}
+	return p.Fail(structDef, what, err)
+}
+
+// outputName expands the {name} placeholder of pattern for the struct
+// structName.
+func outputName(pattern string, structName string) string {
+	return strings.ReplaceAll(pattern, "{name}", strings.ToLower(structName))
+}
+
+// GeneratorName returns the name of the generator named what in messages,
+// such as equal for @equal or field_change.go.
+func GeneratorName(what string) string {
+	for _, c := range generator.Companions {
+		if what == c.Marker || what == c.SupportFile {
+			return c.Name()
+		}
+	}
+	return what
+}
+
+// structInputs returns the inputs of the file generated by what for
+// structDef once its settings are resolved. The position of the struct is
+// left out, so moving its declaration does not invalidate the file, and so
+// are the siblings its fields do not refer to.
+func structInputs(what string, packageName string, structDef *parser.StructDef) []any {
+	def := *structDef
+	def.Position = token.Position{}
+	def.Siblings = usedSiblings(structDef)
+	return []any{what, packageName, def}
+}
+
+// usedSiblings returns the siblings of structDef named in the types of its
+// fields, the only ones its generated code depends on.
+func usedSiblings(structDef *parser.StructDef) map[string]parser.BuilderAnnotations {
+	used := make(map[string]parser.BuilderAnnotations)
+	fset := token.NewFileSet()
+	for _, field := range slices.Concat(structDef.Embedded, structDef.Fields) {
+		var s scanner.Scanner
+		s.Init(fset.AddFile("", -1, len(field.Type)), []byte(field.Type), nil, 0)
+		for {
+			_, tok, lit := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+			if annotations, ok := structDef.Siblings[lit]; ok && tok == token.IDENT {
+				used[lit] = annotations
+			}
+		}
+	}
+	return used
+}
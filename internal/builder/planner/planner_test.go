@@ -0,0 +1,100 @@
+package planner
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	"github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestPlanStruct(t *testing.T) {
+	newStruct := func(name string, annotations parser.BuilderAnnotations) *parser.StructDef {
+		annotations.Prefix = parser.DefaultPrefix
+		return &parser.StructDef{
+			Name:        name,
+			PackageStr:  "model",
+			Fields:      []parser.StructField{{Name: "Name", Type: "string"}},
+			Annotations: annotations,
+		}
+	}
+	pre, err := NewPreamble("header.tmpl", "{{.Generator}} for {{.Types}}\n", "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre.Flags = []string{"-prefix=With"}
+	shared := Settings{Prefix: "With", Output: "zz_builders.go", Mode: ModeBuilder, Preamble: pre}
+
+	var failures []string
+	p := Planner{Fail: func(structDef *parser.StructDef, what string, err error) error {
+		failures = append(failures, structDef.Name+": "+what+": "+err.Error())
+		return nil
+	}}
+	person := newStruct("Person", parser.BuilderAnnotations{Builder: true, Equal: true})
+	team := newStruct("Team", parser.BuilderAnnotations{Builder: true, Equal: true})
+	for _, structDef := range []*parser.StructDef{person, team} {
+		if _, err := p.PlanStruct(structDef, "model", shared, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var paths []string
+	for _, file := range p.Files {
+		paths = append(paths, filepath.ToSlash(file.Path))
+	}
+	want := "model/zz_builders.go model/person_equal.go model/field_change.go model/team_equal.go"
+	if strings.Join(paths, " ") != want {
+		t.Fatalf("planned %s, want %s", strings.Join(paths, " "), want)
+	}
+	builders := p.Files[0]
+	if strings.Join(builders.Types(), ",") != "Person,Team" || builders.Reason != "@builder on Person, @builder on Team" {
+		t.Errorf("shared builder file is %+v", builders)
+	}
+	if p.Files[2].Types() != nil || p.Files[2].Preamble.BuildConstraint != "linux" {
+		t.Errorf("support file is %+v", p.Files[2])
+	}
+
+	content, err := builders.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags, ok := generator.RecordedFlags(content); !ok || strings.Join(flags, " ") != "-prefix=With" {
+		t.Errorf("rendered builders record flags %q, %v", flags, ok)
+	}
+	for _, want := range []string{"//go:build linux\n", "// builder for Person, Team\n", "type TeamBuilder struct"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("rendered builders missing %q:\n%s", want, content)
+		}
+	}
+
+	// Structs of another package cannot share the file
+	other := newStruct("Pet", parser.BuilderAnnotations{Builder: true})
+	otherSettings := shared
+	otherSettings.Package = "fixtures"
+	if files, err := p.PlanStruct(other, "model", otherSettings, ""); err != nil || len(files) != 0 {
+		t.Fatalf("PlanStruct() = %v, %v", files, err)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0], "is generated in package model for Person, not fixtures") {
+		t.Errorf("failures are %q", failures)
+	}
+
+	// Without Fail, the error is returned
+	p = Planner{Selected: func(name string) bool { return name == "equal" }}
+	if _, err := p.PlanStruct(newStruct("Person", parser.BuilderAnnotations{Builder: true, Equal: true}), "model", shared, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Files) != 2 {
+		t.Fatalf("expected the equal files alone, got %d files", len(p.Files))
+	}
+	conflict := shared
+	conflict.Output = "{name}_equal.go"
+	p.Selected = nil
+	_, err = p.PlanStruct(newStruct("Person", parser.BuilderAnnotations{Builder: true}), "model", conflict, "")
+	if err == nil || !strings.Contains(err.Error(), "is also generated by @equal for Person") {
+		t.Errorf("expected a conflict with the equal file, got %v", err)
+	}
+	if _, err := NewPreamble("", "", "linux &&"); err == nil {
+		t.Error("expected an error for an invalid build constraint")
+	}
+}
@@ -0,0 +1,307 @@
+// Package cli implements the command lines of the generators: the
+// generators command with its subcommands, and the flag-only generator
+// binary run by go:generate directives. Both share flag parsing,
+// configuration loading and generation.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nanostack-dev/generators/internal/builder/loader"
+)
+
+// command is a subcommand of the generators command.
+type command struct {
+	name string
+	// args is the synopsis of the arguments following the flags
+	args    string
+	summary string
+	// flags names the flags the command accepts
+	flags []string
+	run   func(cfg config, stdout io.Writer) error
+}
+
+// settingsFlags are the flags giving settings, accepted by every command
+// resolving them.
+var settingsFlags = []string{"config", "prefix", "output", "package", "validate", "mode", "header-file", "build-constraint", "templates"}
+
+var commands = []command{
+	{
+		name:    "generate",
+		args:    "[packages]",
+		summary: "generate code for the annotated structs of packages",
+		flags: append([]string{
+			"dir", "tags", "file", "type", "only",
+			"dry-run", "stdout", "keep-going", "j", "force", "prune", "watch", "watch-interval", "report",
+		}, settingsFlags...),
+		run: runGenerate,
+	},
+	{
+		name:    "check",
+		args:    "[packages]",
+		summary: "report generated files that are out of date, without writing them",
+		flags:   append([]string{"dir", "tags", "file", "type", "only", "keep-going", "j", "prune", "report"}, settingsFlags...),
+		run: func(cfg config, stdout io.Writer) error {
+			cfg.check = true
+			return runGenerate(cfg, stdout)
+		},
+	},
+	{
+		name:    "list",
+		args:    "[packages]",
+		summary: "list the annotated structs, their effective settings and the files generated for them",
+		flags:   append([]string{"dir", "tags", "file", "only", "format"}, settingsFlags...),
+		run:     runList,
+	},
+	{
+		name:    "explain",
+		args:    "type [packages]",
+		summary: "show where the settings of a struct come from",
+		flags:   append([]string{"dir", "tags", "file"}, settingsFlags...),
+		run:     runExplain,
+	},
+	{
+		name:    "init",
+		summary: "write a " + configFileName + " holding the default settings to -dir",
+		flags:   []string{"dir"},
+		run:     runInit,
+	},
+	{
+		name:    "clean",
+		args:    "[packages]",
+		summary: "delete every generated file of packages",
+		flags:   []string{"dir", "tags", "dry-run"},
+		run:     runClean,
+	},
+}
+
+// Run runs the generators command for the command line args: a subcommand
+// followed by its flags and arguments.
+func Run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		printUsage(stdout)
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		usage := fmt.Sprintf("usage: generators %s [flags] %s\n\n%s.", cmd.name, cmd.args, upperFirst(cmd.summary))
+		if strings.Contains(cmd.args, "[packages]") {
+			usage += " Packages default to ./... relative to -dir."
+		}
+		cfg, err := parseFlags(cmd.name, usage+"\n", cmd.flags, args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return cmd.run(cfg, stdout)
+	}
+	return fmt.Errorf("unknown command %q, run generators help for the list of commands", args[0])
+}
+
+// printUsage lists the commands.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: generators <command> [flags] [arguments]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun generators <command> -h for the flags of a command.\n")
+}
+
+// upperFirst returns s with its first letter in upper case.
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// listedStruct is an annotated struct as printed by list -format json.
+type listedStruct struct {
+	Type     string         `json:"type"`
+	Declared string         `json:"declared"`
+	Settings listedSettings `json:"settings"`
+	Files    []listedFile   `json:"files"`
+}
+
+// listedSettings are the settings in effect for a struct once the
+// configuration file, annotations and flags are merged.
+type listedSettings struct {
+	Prefix    string `json:"prefix"`
+	Output    string `json:"output"`
+	Package   string `json:"package"`
+	Validate  bool   `json:"validate"`
+	Immutable bool   `json:"immutable"`
+	Mode      string `json:"mode"`
+}
+
+// listedFile is a file generated for a listed struct.
+type listedFile struct {
+	Generator string `json:"generator"`
+	Path      string `json:"path"`
+	Reason    string `json:"reason"`
+}
+
+// runList prints the annotated structs of the packages with their
+// effective settings and the files generated for them: a table with a
+// line per file, or a JSON array of structs.
+func runList(cfg config, stdout io.Writer) error {
+	g, err := planGeneration(cfg, stdout)
+	if err != nil {
+		return err
+	}
+
+	listed := make([]listedStruct, 0, len(g.structs))
+	for _, planned := range g.structs {
+		s := listedStruct{
+			Type:     planned.structDef.Name,
+			Declared: displayPosition(planned.structDef.Position),
+			Settings: listedSettings{
+				Prefix:    planned.settings.Prefix,
+				Output:    planned.settings.Output,
+				Package:   planned.packageName,
+				Validate:  planned.settings.validate(),
+				Immutable: planned.structDef.Annotations.Immutable,
+				Mode:      planned.settings.Mode,
+			},
+			Files: make([]listedFile, 0, len(planned.files)),
+		}
+		for _, file := range planned.files {
+			s.Files = append(s.Files, listedFile{Generator: file.what, Path: displayPath(file.path), Reason: file.reason})
+		}
+		listed = append(listed, s)
+	}
+
+	if cfg.format == formatJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tGENERATOR\tFILE\tPREFIX\tPACKAGE\tVALIDATE\tIMMUTABLE\tDECLARED")
+	for _, s := range listed {
+		for _, file := range s.Files {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\t%t\t%s\n", s.Type, file.Generator, file.Path,
+				s.Settings.Prefix, s.Settings.Package, s.Settings.Validate, s.Settings.Immutable, s.Declared)
+		}
+	}
+	return tw.Flush()
+}
+
+// runExplain prints the settings layers of the structs named by the first
+// argument and the files generated for them.
+func runExplain(cfg config, stdout io.Writer) error {
+	if len(cfg.patterns) == 0 {
+		return fmt.Errorf("explain needs the name of a struct")
+	}
+	typeName := cfg.patterns[0]
+	cfg.patterns = cfg.patterns[1:]
+
+	g, err := planGeneration(cfg, stdout)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, planned := range g.structs {
+		if planned.structDef.Name != typeName {
+			continue
+		}
+		if found {
+			fmt.Fprintln(stdout)
+		}
+		found = true
+
+		fmt.Fprintf(stdout, "%s declared at %s\n\nSettings, from the lowest to the highest precedence:\n",
+			typeName, displayPosition(planned.structDef.Position))
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, layer := range planned.layers {
+			fmt.Fprintf(tw, "  %s\t%s\n", layer.source, layer.settings)
+		}
+		fmt.Fprintf(tw, "  effective\t%s\n", planned.settings)
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "\nFiles:\n")
+		tw = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, file := range planned.files {
+			fmt.Fprintf(tw, "  %s\t%s\t(%s)\n", file.what, displayPath(file.path), file.reason)
+		}
+		if len(planned.files) == 0 {
+			fmt.Fprintf(tw, "  none\n")
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no struct named %s with generator annotations", typeName)
+	}
+	if len(g.errs) > 0 {
+		return errors.Join(g.errs...)
+	}
+	return nil
+}
+
+// runInit writes a configuration file holding the default settings to
+// -dir. An existing file is left alone.
+func runInit(cfg config, stdout io.Writer) error {
+	path := filepath.Join(cfg.dir, configFileName)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	content, err := json.MarshalIndent(projectConfig{settings: defaultSettings}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", path)
+	return nil
+}
+
+// runClean deletes every generated file of the packages, or lists them in
+// dry-run mode.
+func runClean(cfg config, stdout io.Writer) error {
+	pkgs, err := loader.Load(loader.Config{Dir: cfg.dir, Tags: cfg.buildTags()}, token.NewFileSet(), cfg.packagePatterns()...)
+	if err != nil {
+		return err
+	}
+
+	g := &generation{cfg: cfg, stdout: stdout}
+	for _, pkg := range pkgs {
+		if pkg.Dir != "" {
+			g.dirs = append(g.dirs, pkg.Dir)
+		}
+	}
+	return g.deleteGenerated("generated")
+}
+
+// displayPosition returns pos with its file name shortened by displayPath.
+func displayPosition(pos token.Position) string {
+	pos.Filename = displayPath(pos.Filename)
+	return pos.String()
+}
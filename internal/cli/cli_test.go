@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModule writes files, by path relative to a new temporary directory,
+// and returns the directory.
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunCommands(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":         "module example.com/app\n\ngo 1.24\n",
+		"model/model.go": "package model\n\n// @builder\n// @equal\ntype Person struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "help",
+			args: nil,
+			want: []string{"usage: generators <command>", "  explain   show where the settings of a struct come from"},
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"build"},
+			wantErr: true,
+		},
+		{
+			name: "command help",
+			args: []string{"list", "-h"},
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"list", "-dir", dir, "-nope"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid flag value",
+			args:    []string{"generate", "-dir", dir, "-j", "many"},
+			wantErr: true,
+		},
+		{
+			name: "list",
+			args: []string{"list", "-dir", dir},
+			want: []string{"TYPE", "Person  builder    " + filepath.Join(modelDir, "person_builder.go"), "Person  equal      " + filepath.Join(modelDir, "person_equal.go")},
+		},
+		{
+			name:    "list only",
+			args:    []string{"list", "-dir", dir, "-only", "equal"},
+			want:    []string{"Person  equal"},
+			notWant: []string{"builder"},
+		},
+		{
+			name: "explain",
+			args: []string{"explain", "-dir", dir, "-prefix", "Set", "Person"},
+			want: []string{
+				"Person declared at " + filepath.Join(modelDir, "model.go") + ":5:6",
+				"  flags                         prefix=Set\n",
+				"  effective                     prefix=Set output={name}_builder.go mode=builder\n",
+				"  builder  " + filepath.Join(modelDir, "person_builder.go") + "  (@builder on Person)\n",
+			},
+		},
+		{
+			name:    "explain unknown struct",
+			args:    []string{"explain", "-dir", dir, "Team"},
+			wantErr: true,
+		},
+		{
+			name:    "explain without struct",
+			args:    []string{"explain", "-dir", dir},
+			wantErr: true,
+		},
+		{
+			name:    "unknown generator",
+			args:    []string{"generate", "-dir", dir, "-only", "builder,mock"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := Run(tt.args, &stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, stdout.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(stdout.String(), notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunGenerateOnlyAndClean(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":         "module example.com/app\n\ngo 1.24\n",
+		"model/model.go": "package model\n\n// @builder\n// @equal\ntype Person struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+	builderFile := filepath.Join(modelDir, "person_builder.go")
+	equalFile := filepath.Join(modelDir, "person_equal.go")
+
+	if err := Run([]string{"generate", "-dir", dir, "-only", "builder"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(builderFile); err != nil {
+		t.Errorf("builder was not generated: %v", err)
+	}
+	if _, err := os.Stat(equalFile); !os.IsNotExist(err) {
+		t.Error("-only builder generated the equal methods")
+	}
+
+	if err := Run([]string{"check", "-dir", dir, "-only", "builder"}, io.Discard); err != nil {
+		t.Errorf("builder should be up to date: %v", err)
+	}
+	if err := Run([]string{"check", "-dir", dir}, io.Discard); err == nil {
+		t.Error("check should report the missing equal methods")
+	}
+	if err := Run([]string{"generate", "-dir", dir, "-only", "builder", "-prune"}, io.Discard); err == nil {
+		t.Error("expected an error for -prune with -only")
+	}
+
+	if err := Run([]string{"clean", "-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(builderFile); !os.IsNotExist(err) {
+		t.Error("clean left the builder behind")
+	}
+	if _, err := os.Stat(filepath.Join(modelDir, "model.go")); err != nil {
+		t.Errorf("clean deleted the source file: %v", err)
+	}
+}
+
+func TestRunInit(t *testing.T) {
+	dir := t.TempDir()
+	if err := Run([]string{"init", "-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(filepath.Join(dir, configFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.settings != defaultSettings {
+		t.Errorf("init wrote %+v, want the defaults %+v", config.settings, defaultSettings)
+	}
+
+	if err := Run([]string{"init", "-dir", dir}, io.Discard); err == nil {
+		t.Error("init should not overwrite an existing configuration file")
+	}
+}
+
+func TestRunListJSON(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"generators.json": `{"validate": true, "packages": {"model": {"output": "zz_{name}_builder.go"}}}`,
+		"model/model.go":  "package model\n\n// @builder\n// @builder:prefix Set\n// @builder:immutable\ntype Person struct{ Name string }\n",
+	})
+
+	var stdout bytes.Buffer
+	if err := Run([]string{"list", "-dir", dir, "-format", "json", "-package", "fixtures"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []listedStruct
+	if err := json.Unmarshal(stdout.Bytes(), &listed); err != nil {
+		t.Fatalf("list output is not JSON: %v\n%s", err, stdout.String())
+	}
+	if len(listed) != 1 {
+		t.Fatalf("expected one struct, got %d", len(listed))
+	}
+	want := listedSettings{
+		Prefix:    "Set",
+		Output:    "zz_{name}_builder.go",
+		Package:   "fixtures",
+		Validate:  true,
+		Immutable: true,
+		Mode:      "builder",
+	}
+	if listed[0].Type != "Person" || listed[0].Settings != want {
+		t.Errorf("listed %s with %+v, want Person with %+v", listed[0].Type, listed[0].Settings, want)
+	}
+	wantFile := listedFile{
+		Generator: "builder",
+		Path:      filepath.Join(dir, "model", "zz_person_builder.go"),
+		Reason:    "@builder on Person",
+	}
+	if len(listed[0].Files) != 1 || listed[0].Files[0] != wantFile {
+		t.Errorf("listed files %+v, want %+v", listed[0].Files, wantFile)
+	}
+
+	if err := Run([]string{"list", "-dir", dir, "-format", "yaml"}, io.Discard); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileName is the project configuration looked up from the generated
+// directory towards the file system root.
+const configFileName = "generators.json"
+
+// settings are the generator options that can be set by the configuration
+// file, struct annotations and flags. Empty values are unset and leave the
+// value of the layer below in place.
+type settings struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Package string `json:"package,omitempty"`
+	// Validate is nil when unset, so that a layer can turn validation off
+	// as well as on
+	Validate *bool  `json:"validate,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	// HeaderFile is a text/template rendered as a comment below the header
+	// of generated files, relative to the configuration file when read
+	// from it
+	HeaderFile string `json:"headerFile,omitempty"`
+	// BuildConstraint is the //go:build expression of generated files,
+	// which otherwise get the constraint of their source file
+	BuildConstraint string `json:"buildConstraint,omitempty"`
+	// Templates is a directory of extension templates, in a subdirectory
+	// per generator such as builder/must_build.tmpl, relative to the
+	// configuration file when read from it
+	Templates string `json:"templates,omitempty"`
+}
+
+// override returns s with the values set in o replacing its own.
+func (s settings) override(o settings) settings {
+	if o.Prefix != "" {
+		s.Prefix = o.Prefix
+	}
+	if o.Output != "" {
+		s.Output = o.Output
+	}
+	if o.Package != "" {
+		s.Package = o.Package
+	}
+	if o.Validate != nil {
+		s.Validate = o.Validate
+	}
+	if o.Mode != "" {
+		s.Mode = o.Mode
+	}
+	if o.HeaderFile != "" {
+		s.HeaderFile = o.HeaderFile
+	}
+	if o.BuildConstraint != "" {
+		s.BuildConstraint = o.BuildConstraint
+	}
+	if o.Templates != "" {
+		s.Templates = o.Templates
+	}
+	return s
+}
+
+// validate reports whether s enables validation.
+func (s settings) validate() bool {
+	return s.Validate != nil && *s.Validate
+}
+
+// String formats the values set in s, as shown by the explain command.
+func (s settings) String() string {
+	var values []string
+	if s.Prefix != "" {
+		values = append(values, "prefix="+s.Prefix)
+	}
+	if s.Output != "" {
+		values = append(values, "output="+s.Output)
+	}
+	if s.Package != "" {
+		values = append(values, "package="+s.Package)
+	}
+	if s.Validate != nil {
+		values = append(values, "validate="+strconv.FormatBool(*s.Validate))
+	}
+	if s.Mode != "" {
+		values = append(values, "mode="+s.Mode)
+	}
+	if s.HeaderFile != "" {
+		values = append(values, "headerFile="+s.HeaderFile)
+	}
+	if s.BuildConstraint != "" {
+		values = append(values, "buildConstraint="+s.BuildConstraint)
+	}
+	if s.Templates != "" {
+		values = append(values, "templates="+s.Templates)
+	}
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return strings.Join(values, " ")
+}
+
+// projectConfig is the content of generators.json. Top-level settings apply
+// to every package; Packages overrides them for the package in a directory,
+// relative to the configuration file, and for its types by name:
+//
+//	{
+//	  "prefix": "Set",
+//	  "validate": true,
+//	  "packages": {
+//	    "internal/model": {
+//	      "output": "zz_{name}_builder.go",
+//	      "types": {"Person": {"mode": "options"}}
+//	    }
+//	  }
+//	}
+type projectConfig struct {
+	settings
+	Packages map[string]packageConfig `json:"packages,omitempty"`
+
+	// path is the configuration file and dir the directory holding it,
+	// both empty when none was found
+	path string
+	dir  string
+}
+
+type packageConfig struct {
+	settings
+	Types map[string]settings `json:"types,omitempty"`
+}
+
+// findConfig looks for generators.json in dir and its parents. It returns
+// an empty configuration when there is none.
+func findConfig(dir string) (*projectConfig, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return loadConfig(path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &projectConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads the configuration file at path.
+func loadConfig(path string) (*projectConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config projectConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	config.path = path
+	config.dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Header files and template directories are relative to the
+	// configuration file
+	config.resolvePaths(&config.settings)
+	for dir, pkg := range config.Packages {
+		config.resolvePaths(&pkg.settings)
+		for name, typeSettings := range pkg.Types {
+			config.resolvePaths(&typeSettings)
+			pkg.Types[name] = typeSettings
+		}
+		config.Packages[dir] = pkg
+	}
+	return &config, nil
+}
+
+// resolvePaths makes the header file and template directory of s relative
+// to the directory of the configuration file.
+func (c *projectConfig) resolvePaths(s *settings) {
+	if s.HeaderFile != "" && !filepath.IsAbs(s.HeaderFile) {
+		s.HeaderFile = filepath.Join(c.dir, s.HeaderFile)
+	}
+	if s.Templates != "" && !filepath.IsAbs(s.Templates) {
+		s.Templates = filepath.Join(c.dir, s.Templates)
+	}
+}
+
+// source describes where the configuration was read from.
+func (c *projectConfig) source() string {
+	if c.path == "" {
+		return configFileName + " (none found)"
+	}
+	return c.path
+}
+
+// settingsFor returns the configured settings of the type typeName declared
+// in dir: the top-level settings, overridden by those of its package and
+// then by those of the type.
+func (c *projectConfig) settingsFor(dir string, typeName string) settings {
+	s := c.settings
+	if c.dir == "" {
+		return s
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return s
+	}
+	rel, err := filepath.Rel(c.dir, absDir)
+	if err != nil {
+		return s
+	}
+
+	pkg, ok := c.Packages[filepath.ToSlash(rel)]
+	if !ok {
+		return s
+	}
+	return s.override(pkg.settings).override(pkg.Types[typeName])
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "internal", "model")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := findConfig(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.dir != "" {
+		t.Errorf("found a configuration in %s, want none", config.dir)
+	}
+
+	content := `{
+		"prefix": "Set",
+		"output": "{name}_gen.go",
+		"packages": {
+			"internal/model": {
+				"package": "models",
+				"types": {"Person": {"prefix": "Put", "mode": "options"}}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(root, configFileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err = findConfig(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		typeName string
+		want     settings
+	}{
+		{
+			name:     "root package",
+			dir:      root,
+			typeName: "Person",
+			want:     settings{Prefix: "Set", Output: "{name}_gen.go"},
+		},
+		{
+			name:     "configured package",
+			dir:      nested,
+			typeName: "Team",
+			want:     settings{Prefix: "Set", Output: "{name}_gen.go", Package: "models"},
+		},
+		{
+			name:     "configured type",
+			dir:      nested,
+			typeName: "Person",
+			want:     settings{Prefix: "Put", Output: "{name}_gen.go", Package: "models", Mode: "options"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.settingsFor(tt.dir, tt.typeName); got != tt.want {
+				t.Errorf("settingsFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findConfig(dir); err == nil {
+		t.Error("expected an error for an invalid configuration file")
+	}
+}
@@ -0,0 +1,1112 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nanostack-dev/generators/internal/builder/diff"
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	"github.com/nanostack-dev/generators/internal/builder/loader"
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+	"github.com/nanostack-dev/generators/internal/builder/planner"
+)
+
+type config struct {
+	dir        string
+	patterns   []string
+	tags       string
+	file       string
+	typeName   string
+	configFile string
+	// flags holds the settings given explicitly on the command line
+	flags     settings
+	check     bool
+	dryRun    bool
+	stdout    bool
+	keepGoing bool
+	jobs      int
+	force     bool
+	prune     bool
+	// only restricts the run to the named generators, all when nil
+	only []string
+	// format is the output format of the list command
+	format string
+	// report is the format of the run summary, none when empty
+	report string
+	// watch keeps the generator running, polling every watchInterval
+	watch         bool
+	watchInterval time.Duration
+	// sink receives the files written, a generator.DirSink when nil
+	sink generator.Sink
+}
+
+// packagePatterns returns the package patterns to load, ./... when none
+// were given.
+func (cfg config) packagePatterns() []string {
+	if len(cfg.patterns) == 0 {
+		return []string{"./..."}
+	}
+	return cfg.patterns
+}
+
+// selected reports whether the generator name runs, as set by -only.
+func (cfg config) selected(name string) bool {
+	return cfg.only == nil || slices.Contains(cfg.only, name)
+}
+
+// buildContext returns the build context packages are loaded with: the
+// GOOS and GOARCH the go command sees, and the tags given by -tags.
+func (cfg config) buildContext() build.Context {
+	ctxt := build.Default
+	if goos := os.Getenv("GOOS"); goos != "" {
+		ctxt.GOOS = goos
+	}
+	if goarch := os.Getenv("GOARCH"); goarch != "" {
+		ctxt.GOARCH = goarch
+	}
+	ctxt.BuildTags = cfg.buildTags()
+	return ctxt
+}
+
+// buildTags returns the build tags given by -tags.
+func (cfg config) buildTags() []string {
+	if cfg.tags == "" {
+		return nil
+	}
+	return strings.Split(cfg.tags, ",")
+}
+
+// defaultSettings apply when neither the configuration file, the struct
+// annotations nor the flags say otherwise.
+var defaultSettings = settings{
+	Prefix: genparser.DefaultPrefix,
+	Output: "{name}_builder.go",
+	Mode:   modeBuilder,
+}
+
+// Output formats selectable with -format.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// Generation modes selectable with -mode for structs annotated with @builder.
+const (
+	modeBuilder = planner.ModeBuilder
+	modeOptions = planner.ModeOptions
+)
+
+// companions are the generators other than the builder.
+var companions = generator.Companions
+
+// RunGenerator generates for the command line args of the flag-only
+// generator binary, as used by go:generate directives.
+func RunGenerator(args []string, stdout io.Writer) error {
+	cfg, err := parseConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return runGenerate(cfg, stdout)
+}
+
+// runGenerate generates for cfg. The check, dry-run and stdout modes write
+// their report or the generated code to stdout, as does watch mode its
+// status lines.
+func runGenerate(cfg config, stdout io.Writer) error {
+	if cfg.report != "" {
+		return reportGenerate(cfg, stdout)
+	}
+
+	log.Printf("Generating builders with config: %+v\n", cfg)
+
+	if cfg.watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return watch(ctx, cfg, stdout)
+	}
+
+	_, err := generate(cfg, stdout)
+	return err
+}
+
+// generatorFlags are the flags of the generator binary.
+var generatorFlags = []string{
+	"dir", "tags", "file", "type", "config",
+	"prefix", "output", "package", "validate", "mode", "header-file", "build-constraint", "templates", "only",
+	"check", "dry-run", "stdout", "keep-going", "j", "force", "prune", "watch", "watch-interval", "report",
+}
+
+// parseConfig parses the command line args of the generator binary.
+func parseConfig(args []string) (config, error) {
+	usage := "usage: generator [flags] [packages]\n\nPackages default to ./... relative to -dir.\n"
+	return parseFlags("generator", usage, generatorFlags, args)
+}
+
+// parseFlags parses the command line args of the command name, which
+// accepts the flags listed in accepted. Every command defines and checks
+// its flags here, so a flag means the same whatever the command. Invalid
+// flags are reported with the usage, and -h returns flag.ErrHelp once the
+// usage is printed.
+func parseFlags(name string, usage string, accepted []string, args []string) (config, error) {
+	// Create config to store flag values
+	cfg := config{}
+	var flagSettings settings
+	var validate bool
+	var only string
+
+	// Define every flag, then keep the accepted ones
+	all := flag.NewFlagSet(name, flag.ContinueOnError)
+	all.StringVar(&cfg.dir, "dir", ".", "directory package patterns are resolved from")
+	all.StringVar(&cfg.tags, "tags", "", "comma-separated build tags to honour when loading packages")
+	all.StringVar(&cfg.file, "file", "", "generate for a single file instead of scanning -dir (default: $GOFILE when -type is set)")
+	all.StringVar(&cfg.typeName, "type", "", "struct to generate for within -file, annotated or not")
+	all.StringVar(&cfg.configFile, "config", "", "configuration file (default: "+configFileName+" in the generated directory or a parent)")
+	all.StringVar(&flagSettings.Prefix, "prefix", defaultSettings.Prefix, "prefix for builder methods")
+	all.StringVar(&flagSettings.Output, "output", defaultSettings.Output, "output file pattern. Use {name} as placeholder for struct name")
+	all.StringVar(&flagSettings.Package, "package", "", "override package name")
+	all.BoolVar(&validate, "validate", false, "generate validation methods")
+	all.StringVar(&flagSettings.Mode, "mode", defaultSettings.Mode, "what to generate for @builder structs: builder or options")
+	all.StringVar(&flagSettings.HeaderFile, "header-file", "", "text/template file rendered as a comment below the header of generated files")
+	all.StringVar(&flagSettings.BuildConstraint, "build-constraint", "", "//go:build expression of generated files (default: the constraint of their source file)")
+	all.StringVar(&flagSettings.Templates, "templates", "", "directory of text/template extensions adding or replacing generated methods, in a subdirectory per generator")
+	all.BoolVar(&cfg.check, "check", false, "report generated files that are out of date instead of writing them")
+	all.BoolVar(&cfg.dryRun, "dry-run", false, "list the files that would be generated and why, without writing them")
+	all.BoolVar(&cfg.stdout, "stdout", false, "write the code generated for -type to stdout instead of a file")
+	all.BoolVar(&cfg.keepGoing, "keep-going", false, "generate for the remaining structs after a failure and report every error at the end")
+	all.IntVar(&cfg.jobs, "j", runtime.GOMAXPROCS(0), "number of files parsed and generated concurrently")
+	all.BoolVar(&cfg.force, "force", false, "regenerate files even when their recorded input hash is unchanged")
+	all.BoolVar(&cfg.prune, "prune", false, "delete generated files of the loaded packages that this run no longer produces")
+	all.BoolVar(&cfg.watch, "watch", false, "keep running and regenerate when the Go files of the packages change")
+	all.DurationVar(&cfg.watchInterval, "watch-interval", 500*time.Millisecond, "how often -watch polls for changes")
+	all.StringVar(&cfg.report, "report", "", "print a summary of the run in the given format instead of the usual output: "+formatJSON)
+	all.StringVar(&cfg.format, "format", formatTable, "output format: "+formatTable+" or "+formatJSON)
+	all.StringVar(&only, "only", "", "comma-separated generators to run: "+strings.Join(generator.GeneratorNames(), ", ")+" (default: all)")
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	all.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(accepted, f.Name) {
+			flags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "%s\n", usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	cfg.patterns = flags.Args()
+
+	// Only flags given explicitly override the configuration file and the
+	// annotations, whatever their value
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "prefix":
+			cfg.flags.Prefix = flagSettings.Prefix
+		case "output":
+			cfg.flags.Output = flagSettings.Output
+		case "package":
+			cfg.flags.Package = flagSettings.Package
+		case "validate":
+			cfg.flags.Validate = &validate
+		case "mode":
+			cfg.flags.Mode = flagSettings.Mode
+		case "header-file":
+			cfg.flags.HeaderFile = flagSettings.HeaderFile
+		case "build-constraint":
+			cfg.flags.BuildConstraint = flagSettings.BuildConstraint
+		case "templates":
+			cfg.flags.Templates = flagSettings.Templates
+		}
+	})
+
+	if err := checkMode(cfg.flags.Mode); err != nil {
+		return config{}, err
+	}
+	if only != "" {
+		cfg.only = strings.Split(only, ",")
+		for _, name := range cfg.only {
+			if !slices.Contains(generator.GeneratorNames(), name) {
+				return config{}, fmt.Errorf("unknown generator %q in -only: expected %s", name, strings.Join(generator.GeneratorNames(), ", "))
+			}
+		}
+	}
+
+	if countTrue(cfg.check, cfg.dryRun, cfg.stdout, cfg.watch) > 1 {
+		return config{}, fmt.Errorf("-check, -dry-run, -stdout and -watch are mutually exclusive")
+	}
+	if cfg.stdout && cfg.typeName == "" {
+		return config{}, fmt.Errorf("-stdout requires -type")
+	}
+	if cfg.prune && (cfg.file != "" || cfg.typeName != "") {
+		return config{}, fmt.Errorf("-prune needs packages and cannot be combined with -file or -type")
+	}
+	if cfg.format != formatTable && cfg.format != formatJSON {
+		return config{}, fmt.Errorf("unknown format %q: expected %s or %s", cfg.format, formatTable, formatJSON)
+	}
+	if cfg.report != "" && cfg.report != formatJSON {
+		return config{}, fmt.Errorf("unknown report format %q: expected %s", cfg.report, formatJSON)
+	}
+	if cfg.report != "" && (cfg.stdout || cfg.watch) {
+		return config{}, fmt.Errorf("-report cannot be combined with -stdout or -watch")
+	}
+	if cfg.prune && cfg.only != nil {
+		return config{}, fmt.Errorf("-prune cannot be combined with -only, which leaves the files of other generators out of the run")
+	}
+	if cfg.jobs < 1 {
+		return config{}, fmt.Errorf("-j must be at least 1, got %d", cfg.jobs)
+	}
+	if cfg.watchInterval <= 0 {
+		return config{}, fmt.Errorf("-watch-interval must be positive, got %s", cfg.watchInterval)
+	}
+
+	// go generate exports the file holding the directive as $GOFILE
+	if cfg.typeName != "" && cfg.file == "" {
+		cfg.file = os.Getenv("GOFILE")
+		if cfg.file == "" {
+			return config{}, fmt.Errorf("-type requires -file when not run by go generate")
+		}
+	}
+
+	return cfg, nil
+}
+
+// generate runs the generation described by cfg once. The returned
+// generation is nil when the packages or files could not be loaded.
+func generate(cfg config, stdout io.Writer) (*generation, error) {
+	g, err := planGeneration(cfg, stdout)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.emitPlanned(); err != nil {
+		return g, err
+	}
+	if cfg.prune {
+		if err := g.pruneOrphans(); err != nil {
+			return g, err
+		}
+	}
+	if len(g.errs) > 0 {
+		return g, fmt.Errorf("generation failed with %d error(s):\n%w", len(g.errs), errors.Join(g.errs...))
+	}
+
+	if len(g.stale) > 0 {
+		return g, fmt.Errorf("%d generated file(s) out of date, run the generator to update them: %s",
+			len(g.stale), strings.Join(g.stale, ", "))
+	}
+
+	if cfg.stdout {
+		return g, g.writeStdout()
+	}
+	return g, nil
+}
+
+// planGeneration loads the packages or file of cfg and plans the files to
+// generate for their structs, without emitting them.
+func planGeneration(cfg config, stdout io.Writer) (*generation, error) {
+	g, err := newGeneration(cfg, stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.file != "" {
+		err = g.generateTarget()
+	} else {
+		err = g.generateBuilders()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// newGeneration returns an empty generation for cfg, with the settings of
+// its configuration file.
+func newGeneration(cfg config, stdout io.Writer) (*generation, error) {
+	project, err := loadProjectConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.sink == nil {
+		cfg.sink = generator.DirSink{}
+	}
+
+	g := &generation{
+		cfg:          cfg,
+		project:      project,
+		stdout:       stdout,
+		produced:     make(map[string]bool),
+		packageIndex: make(map[string]int),
+
+		headers:    make(map[string]string),
+		extensions: make(map[string]planner.Extensions),
+	}
+	g.planner = planner.Planner{Selected: cfg.selected, Fail: g.fail}
+	return g, nil
+}
+
+// PlannedFile is a file the generators write for the structs of a
+// package, as returned by Plan.
+type PlannedFile struct {
+	Path string
+	// Generator is the generator writing the file, such as builder
+	Generator string
+	// Types are the structs the file is generated for
+	Types []*genparser.StructDef
+	// InputHash is the hash the file records once generated, telling
+	// whether an existing file is up to date
+	InputHash string
+}
+
+// Plan returns the files generated for structDefs, parsed from the
+// package in dir, with the settings of the configuration file found from
+// dir and the settings flags in flags, as recorded in the header of
+// generated files. Relative paths in flags are resolved against dir. The
+// settings resolved for each struct are applied to it, as they are before
+// generating. Files are planned for every valid struct, and the errors of
+// the others are returned along with them.
+func Plan(dir string, structDefs []*genparser.StructDef, flags []string) ([]PlannedFile, error) {
+	cfg, err := parseFlags("plan", "", settingsFlags, flags)
+	if err != nil {
+		return nil, fmt.Errorf("recorded flags %q: %w", flags, err)
+	}
+	cfg.dir, cfg.keepGoing, cfg.jobs = dir, true, 1
+	for _, path := range []*string{&cfg.configFile, &cfg.flags.HeaderFile, &cfg.flags.Templates} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+
+	g, err := newGeneration(cfg, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	for _, structDef := range structDefs {
+		if err := g.generateStruct(structDef, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]PlannedFile, 0, len(g.planner.Files))
+	for _, file := range g.planner.Files {
+		hash, err := file.InputHash()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, PlannedFile{
+			Path:      file.Path,
+			Generator: file.Generator,
+			Types:     file.StructDefs,
+			InputHash: hash,
+		})
+	}
+	return files, errors.Join(g.errs...)
+}
+
+// loadProjectConfig reads the configuration file named by -config, or the
+// one found from the generated directory upwards.
+func loadProjectConfig(cfg config) (*projectConfig, error) {
+	if cfg.configFile != "" {
+		return loadConfig(cfg.configFile)
+	}
+	if cfg.file != "" {
+		return findConfig(filepath.Dir(cfg.file))
+	}
+	return findConfig(cfg.dir)
+}
+
+// checkMode reports an error for a mode other than builder or options. The
+// empty mode is unset.
+func checkMode(mode string) error {
+	if mode != "" && mode != modeBuilder && mode != modeOptions {
+		return fmt.Errorf("unknown mode %q: expected %s or %s", mode, modeBuilder, modeOptions)
+	}
+	return nil
+}
+
+// countTrue returns how many of values are true.
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// parallel calls fn for every index below n from up to workers goroutines
+// and waits for all calls to return.
+func parallel(workers int, n int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// generation holds the state shared by the structs generated in one run.
+// Structs are planned one after the other, then the planned files are
+// rendered and emitted concurrently and their results reported in plan
+// order, so output does not depend on scheduling.
+type generation struct {
+	cfg     config
+	project *projectConfig
+	stdout  io.Writer
+	// planner holds the files to emit, in the order structs were found.
+	planner planner.Planner
+	// structs lists the annotated structs planned, in the order found.
+	structs []plannedStruct
+	// headers caches the sources of the header templates by file name.
+	headers map[string]string
+	// extensions caches the extension templates by directory.
+	extensions map[string]planner.Extensions
+	// dirs lists the directories of the loaded packages, in load order.
+	dirs []string
+	// produced records the files generated by this run, by path, whether
+	// written or already up to date.
+	produced map[string]bool
+	// written lists the files written by this run, in plan order.
+	written []string
+	// stale lists the files found out of date in check mode.
+	stale []string
+	// rendered holds the files generated in stdout mode, in order.
+	rendered []renderedFile
+	// errs collects the failures skipped over with -keep-going.
+	errs []error
+
+	// packages, files and diagnostics are reported by -report; packages
+	// are indexed by directory in packageIndex.
+	packages     []packageReport
+	packageIndex map[string]int
+	files        []fileReport
+	diagnostics  []diagnostic
+}
+
+// fail reports that generating what for structDef failed with err. The
+// error is returned to stop the run, or recorded when -keep-going asks to
+// carry on with the remaining structs.
+func (g *generation) fail(structDef *genparser.StructDef, what string, err error) error {
+	g.diagnostics = append(g.diagnostics, newDiagnostic(structDef, what, err))
+	err = fmt.Errorf("%s: generating %s for %s: %w", structDef.Position, what, structDef.Name, err)
+	if !g.cfg.keepGoing {
+		return err
+	}
+	g.errs = append(g.errs, err)
+	return nil
+}
+
+// renderedFile is a generated file kept in memory.
+type renderedFile struct {
+	path    string
+	content []byte
+}
+
+// plannedStruct records the settings of an annotated struct and the files
+// planned for it, as shown by the list and explain commands.
+type plannedStruct struct {
+	structDef *genparser.StructDef
+	layers    []settingsLayer
+	settings  settings
+	// packageName is the package of the generated files
+	packageName string
+	files       []structFile
+}
+
+// structFile is a file planned for a struct.
+type structFile struct {
+	// what is the name of the generator, as selected by -only
+	what   string
+	path   string
+	reason string
+}
+
+// emitResult is the outcome of emitting a planned file.
+type emitResult struct {
+	// report is the dry-run line or check diff for the file
+	report []byte
+	stale  bool
+	// rendered is set in stdout mode
+	rendered *renderedFile
+	// empty is set when the file rendered to nothing, as for structs
+	// annotated with @builder:skip
+	empty   bool
+	written bool
+	// status is the outcome reported by -report
+	status string
+	err    error
+}
+
+// generateTarget generates for the struct named by -type in -file, or for
+// the annotated structs of -file when no type is given.
+func (g *generation) generateTarget() error {
+	cfg := g.cfg
+	if isSource(cfg.file) {
+		g.addPackage(filepath.Dir(cfg.file), "").Inputs++
+	}
+	siblings, err := otherStructs(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.typeName != "" {
+		structDef, err := genparser.ParseFile(cfg.file, cfg.typeName)
+		if err != nil {
+			return err
+		}
+		// Naming the type is enough to ask for its builder
+		structDef.Annotations.Builder = true
+		genparser.ShareSiblings(append(siblings, structDef))
+		return g.generateStruct(structDef, filepath.Dir(cfg.file))
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, cfg.file, nil, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parsing file %s: %w", cfg.file, err)
+	}
+
+	structDefs := genparser.ParseStructs(fset, f)
+	genparser.ShareSiblings(append(siblings, structDefs...))
+	for _, structDef := range structDefs {
+		if err := g.generateStruct(structDef, filepath.Dir(cfg.file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otherStructs returns the structs declared in the other source files of
+// the package of -file, selected as go build does, whose annotations tell
+// the structs of -file which methods are generated for them.
+func otherStructs(cfg config) ([]*genparser.StructDef, error) {
+	dir := filepath.Dir(cfg.file)
+	ctxt := cfg.buildContext()
+	pkg, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		var noGo *build.NoGoError
+		if errors.As(err, &noGo) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("loading package of %s: %w", cfg.file, err)
+	}
+
+	fset := token.NewFileSet()
+	var structDefs []*genparser.StructDef
+	for _, name := range slices.Concat(pkg.GoFiles, pkg.CgoFiles) {
+		path := filepath.Join(dir, name)
+		if name == filepath.Base(cfg.file) || !isSource(path) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file %s: %w", path, err)
+		}
+		structDefs = append(structDefs, genparser.ParseStructs(fset, f)...)
+	}
+	return structDefs, nil
+}
+
+// generateBuilders generates for the annotated structs of every package
+// matching the configured patterns.
+func (g *generation) generateBuilders() error {
+	cfg := g.cfg
+	fset := token.NewFileSet()
+	pkgs, err := loader.Load(loader.Config{Dir: cfg.dir, Tags: cfg.buildTags()}, fset, cfg.packagePatterns()...)
+	if err != nil {
+		return err
+	}
+
+	var files []loader.File
+	for _, pkg := range pkgs {
+		files = append(files, pkg.Files...)
+		if pkg.Dir != "" {
+			g.dirs = append(g.dirs, pkg.Dir)
+		}
+		g.addPackage(pkg.Dir, pkg.Path)
+	}
+
+	// Look for structs with generator annotations. The file set is safe for
+	// concurrent use and the syntax trees are only read.
+	structDefs := make([][]*genparser.StructDef, len(files))
+	durations := make([]time.Duration, len(files))
+	sources := make([]bool, len(files))
+	parallel(cfg.jobs, len(files), func(i int) {
+		start := time.Now()
+		structDefs[i] = genparser.ParseStructs(fset, files[i].Syntax)
+		sources[i] = isSource(files[i].Path)
+		durations[i] = time.Since(start)
+	})
+
+	for i, file := range files {
+		pkg := g.addPackage(filepath.Dir(file.Path), "")
+		pkg.addDuration(durations[i])
+		if sources[i] {
+			pkg.Inputs++
+		}
+	}
+	// Structs call the methods generated for those of the other source
+	// files of their package
+	first := 0
+	for _, pkg := range pkgs {
+		var shared []*genparser.StructDef
+		for i := first; i < first+len(pkg.Files); i++ {
+			if sources[i] {
+				shared = append(shared, structDefs[i]...)
+			}
+		}
+		genparser.ShareSiblings(shared)
+		first += len(pkg.Files)
+	}
+	for i, file := range files {
+		for _, structDef := range structDefs[i] {
+			if err := g.generateStruct(structDef, filepath.Dir(file.Path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isSource reports whether the file at path is a source the generators read,
+// rather than one they generated.
+func isSource(path string) bool {
+	content, err := os.ReadFile(path)
+	return err == nil && !generator.IsGenerated(content)
+}
+
+// generateStruct plans the builder and companion files requested by the
+// annotations of structDef, to be written into dir by emitPlanned.
+func (g *generation) generateStruct(structDef *genparser.StructDef, dir string) error {
+	cfg := g.cfg
+	if !structDef.Annotations.Builder && !structDef.Annotations.HasCompanion() {
+		return nil
+	}
+
+	layers := g.settingsLayers(structDef, dir)
+	var s settings
+	for _, layer := range layers {
+		s = s.override(layer.settings)
+	}
+	if err := checkMode(s.Mode); err != nil {
+		return g.fail(structDef, "settings", err)
+	}
+	planned := plannedStruct{structDef: structDef, layers: layers, settings: s}
+
+	pre, err := g.preambleFor(s)
+	if err != nil {
+		return g.fail(structDef, "settings", err)
+	}
+	pre.Flags = cfg.recordedFlags(dir)
+	extensions, err := g.extensionsFor(s)
+	if err != nil {
+		return g.fail(structDef, "settings", err)
+	}
+
+	// Reasons record what asked for each file, as listed by -dry-run
+	reason := "@builder on " + structDef.Name
+	if cfg.typeName != "" {
+		reason = "-type " + structDef.Name
+	}
+	files, err := g.planner.PlanStruct(structDef, dir, planner.Settings{
+		Prefix:     s.Prefix,
+		Output:     s.Output,
+		Package:    s.Package,
+		Validate:   s.validate(),
+		Mode:       s.Mode,
+		Preamble:   pre,
+		Extensions: extensions,
+	}, reason)
+	planned.packageName = structDef.PackageStr
+	if s.Package != "" {
+		planned.packageName = s.Package
+	}
+	for _, file := range files {
+		// A shared builder file is listed with the reason of the struct
+		fileReason := file.Reason
+		if file.Generator == "builder" {
+			fileReason = reason
+		}
+		planned.files = append(planned.files, structFile{what: file.Generator, path: file.Path, reason: fileReason})
+	}
+	if err != nil {
+		return err
+	}
+
+	g.structs = append(g.structs, planned)
+	g.addPackage(dir, "").Structs++
+	return nil
+}
+
+// recordedFlags returns the settings flags given explicitly, to record in
+// the files generated into dir so they can be planned again with the same
+// settings. Paths are made relative to dir, as Plan resolves them.
+func (c config) recordedFlags(dir string) []string {
+	var flags []string
+	add := func(name string, value string) {
+		if value != "" {
+			flags = append(flags, "-"+name+"="+value)
+		}
+	}
+	relative := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return abs
+		}
+		if rel, err := filepath.Rel(absDir, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return abs
+	}
+
+	// In the order of settingsFlags
+	add("config", relative(c.configFile))
+	add("prefix", c.flags.Prefix)
+	add("output", c.flags.Output)
+	add("package", c.flags.Package)
+	if c.flags.Validate != nil {
+		add("validate", strconv.FormatBool(*c.flags.Validate))
+	}
+	add("mode", c.flags.Mode)
+	add("header-file", relative(c.flags.HeaderFile))
+	add("build-constraint", c.flags.BuildConstraint)
+	add("templates", relative(c.flags.Templates))
+	return flags
+}
+
+// settingsLayer is one source of the settings of a struct.
+type settingsLayer struct {
+	source   string
+	settings settings
+}
+
+// settingsLayers returns the sources of the settings of structDef, declared
+// in dir, from the lowest to the highest precedence: defaults,
+// configuration file, annotations and explicit flags.
+func (g *generation) settingsLayers(structDef *genparser.StructDef, dir string) []settingsLayer {
+	return []settingsLayer{
+		{source: "defaults", settings: defaultSettings},
+		{source: g.project.source(), settings: g.project.settingsFor(dir, structDef.Name)},
+		{source: "annotations", settings: annotationSettings(structDef.Annotations)},
+		{source: "flags", settings: g.cfg.flags},
+	}
+}
+
+// preambleFor returns the preamble set by s: the header template read from
+// its header file and its build constraint.
+func (g *generation) preambleFor(s settings) (planner.Preamble, error) {
+	var source string
+	if s.HeaderFile != "" {
+		var ok bool
+		if source, ok = g.headers[s.HeaderFile]; !ok {
+			content, err := os.ReadFile(s.HeaderFile)
+			if err != nil {
+				return planner.Preamble{}, fmt.Errorf("reading header: %w", err)
+			}
+			source = string(content)
+			g.headers[s.HeaderFile] = source
+		}
+	}
+	return planner.NewPreamble(filepath.Base(s.HeaderFile), source, s.BuildConstraint)
+}
+
+// extensionsFor returns the extension templates set by s, by generator
+// name: the .tmpl files of the subdirectory of its templates directory
+// named after the generator, in file name order. A generator without a
+// subdirectory has no extensions.
+func (g *generation) extensionsFor(s settings) (map[string]planner.Extensions, error) {
+	if s.Templates == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(s.Templates); err != nil {
+		return nil, fmt.Errorf("reading templates: %w", err)
+	}
+
+	extensions := make(map[string]planner.Extensions)
+	for _, name := range generator.GeneratorNames() {
+		dir := filepath.Join(s.Templates, name)
+		set, ok := g.extensions[dir]
+		if !ok {
+			var err error
+			set, err = planner.ReadExtensions(os.DirFS(s.Templates), name, dir)
+			if err != nil {
+				return nil, err
+			}
+			g.extensions[dir] = set
+		}
+		extensions[name] = set
+	}
+	return extensions, nil
+}
+
+// annotationSettings returns the settings given by the annotations of a
+// struct.
+func annotationSettings(annotations genparser.BuilderAnnotations) settings {
+	s := settings{
+		Prefix:  annotations.Prefix,
+		Output:  annotations.Output,
+		Package: annotations.Package,
+	}
+	// @builder:validate has no value: it can only turn validation on
+	if annotations.Validate {
+		s.Validate = &annotations.Validate
+	}
+	return s
+}
+
+// emitPlanned emits the planned files on up to -j goroutines, then reports
+// their results in plan order. Unless -keep-going is set, files not started
+// yet are skipped after a failure.
+func (g *generation) emitPlanned() error {
+	planned := g.planner.Files
+	results := make([]emitResult, len(planned))
+	durations := make([]time.Duration, len(planned))
+	var failed atomic.Bool
+	parallel(g.cfg.jobs, len(planned), func(i int) {
+		if failed.Load() {
+			return
+		}
+		start := time.Now()
+		results[i] = g.emit(planned[i])
+		durations[i] = time.Since(start)
+		if results[i].err != nil && !g.cfg.keepGoing {
+			failed.Store(true)
+		}
+	})
+
+	var stopErr error
+	for i, result := range results {
+		file := planned[i]
+		// Files that failed or were not started are kept as produced, so
+		// pruning leaves them alone
+		if !result.empty {
+			g.produced[file.Path] = true
+		}
+		g.recordFile(file, result, durations[i])
+		if stopErr != nil {
+			continue
+		}
+		if result.err != nil {
+			stopErr = g.fail(file.StructDefs[0], file.What, result.err)
+			continue
+		}
+		if _, err := g.stdout.Write(result.report); err != nil {
+			return err
+		}
+		if result.stale {
+			g.stale = append(g.stale, file.Path)
+		}
+		if result.written {
+			g.written = append(g.written, file.Path)
+		}
+		if result.rendered != nil {
+			g.rendered = append(g.rendered, *result.rendered)
+		}
+	}
+	return stopErr
+}
+
+// emit writes the source of file to its path through the sink. In check mode it compares the
+// source with the file on disk and reports the differences instead, in
+// dry-run mode it reports the path and the reason it is generated, and in
+// stdout mode it keeps the source for writeStdout. Nothing is emitted when
+// the file renders to nothing. emit is safe for concurrent use.
+//
+// The hash of the file inputs is recorded in its header. When writing, a
+// file recording the same hash is not rendered again unless -force is set,
+// and files are only written when their content changes.
+func (g *generation) emit(file *planner.File) emitResult {
+	hash, err := file.InputHash()
+	if err != nil {
+		return emitResult{err: err}
+	}
+
+	var current []byte
+	var exists bool
+	if !g.cfg.stdout {
+		current, exists, err = readExisting(file.Path)
+		if err != nil {
+			return emitResult{err: err}
+		}
+	}
+
+	writing := !g.cfg.check && !g.cfg.dryRun && !g.cfg.stdout
+	if writing && exists && !g.cfg.force {
+		if recorded, ok := generator.RecordedInputHash(current); ok && recorded == hash {
+			return emitResult{status: statusUnchanged}
+		}
+	}
+
+	content, err := file.Render()
+	if err != nil {
+		return emitResult{err: err}
+	}
+	if content == nil {
+		return emitResult{empty: true, status: statusSkipped}
+	}
+
+	switch {
+	case g.cfg.stdout:
+		return emitResult{rendered: &renderedFile{path: file.Path, content: content}, status: statusRendered}
+	case g.cfg.dryRun:
+		state := statusUnchanged
+		if !exists {
+			state = statusCreate
+		} else if !bytes.Equal(current, content) {
+			state = statusUpdate
+		}
+		return emitResult{report: fmt.Appendf(nil, "%-9s %s (%s)\n", state, file.Path, file.Reason), status: state}
+	case g.cfg.check:
+		fromName := file.Path
+		if !exists {
+			fromName = "/dev/null"
+		}
+		d := diff.Unified(fromName, file.Path, current, content)
+		if d == "" {
+			return emitResult{status: statusUnchanged}
+		}
+		return emitResult{report: []byte(d), stale: true, status: statusStale}
+	}
+
+	// Leave unchanged files alone so their modification time, and the
+	// build cache depending on it, stay valid
+	if exists && bytes.Equal(current, content) {
+		return emitResult{status: statusUnchanged}
+	}
+	if err := g.cfg.sink.WriteFile(file.Path, content); err != nil {
+		return emitResult{err: err}
+	}
+	return emitResult{written: true, status: statusWritten}
+}
+
+// pruneOrphans deletes the generated files of the loaded packages that
+// this run did not produce, such as the builder of a struct that lost its
+// annotation or was renamed.
+func (g *generation) pruneOrphans() error {
+	return g.deleteGenerated("no longer generated")
+}
+
+// deleteGenerated deletes the generated files of the loaded packages that
+// this run did not produce, giving reason in dry-run output. In dry-run mode
+// they are listed instead, and in check mode reported as stale. Files the
+// build context excludes, such as those generated for another GOOS, were
+// not loaded and are left alone.
+func (g *generation) deleteGenerated(reason string) error {
+	ctxt := g.cfg.buildContext()
+	for _, dir := range g.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || filepath.Ext(path) != ".go" || g.produced[path] {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !generator.IsGenerated(content) {
+				continue
+			}
+			if match, err := ctxt.MatchFile(dir, entry.Name()); err != nil {
+				return err
+			} else if !match {
+				continue
+			}
+
+			switch {
+			case g.cfg.dryRun:
+				fmt.Fprintf(g.stdout, "%-9s %s (%s)\n", statusDelete, path, reason)
+				g.files = append(g.files, fileReport{Path: path, Status: statusDelete, Reason: reason})
+			case g.cfg.check:
+				g.stale = append(g.stale, path)
+				fmt.Fprint(g.stdout, diff.Unified(path, "/dev/null", content, nil))
+				g.files = append(g.files, fileReport{Path: path, Status: statusStale, Reason: reason})
+			default:
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				if g.cfg.report == "" {
+					log.Printf("Deleted %s", path)
+				}
+				g.files = append(g.files, fileReport{Path: path, Status: statusDeleted, Reason: reason})
+			}
+		}
+	}
+	return nil
+}
+
+// readExisting returns the content of path and whether it exists.
+func readExisting(path string) ([]byte, bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// writeStdout writes the single file generated in stdout mode. A type
+// generating several files cannot be written as one Go source.
+func (g *generation) writeStdout() error {
+	switch len(g.rendered) {
+	case 0:
+		return fmt.Errorf("nothing generated for %s", g.cfg.typeName)
+	case 1:
+		_, err := g.stdout.Write(g.rendered[0].content)
+		return err
+	}
+
+	paths := make([]string, len(g.rendered))
+	for i, file := range g.rendered {
+		paths[i] = file.path
+	}
+	return fmt.Errorf("-stdout needs a single generated file, %s generates %s",
+		g.cfg.typeName, strings.Join(paths, ", "))
+}
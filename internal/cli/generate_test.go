@@ -0,0 +1,1014 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+)
+
+func TestRunUnknownType(t *testing.T) {
+	inputFile := filepath.Join("..", "..", "cmd", "testdata", "person.go")
+
+	err := RunGenerator([]string{"-file", inputFile, "-type", "Missing", "-output", filepath.Join(t.TempDir(), "out.go")}, io.Discard)
+	if err == nil {
+		t.Error("expected an error for a type missing from -file")
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	inputFile := filepath.Join("..", "..", "cmd", "testdata", "person.go")
+	outputFile := filepath.Join(t.TempDir(), "person_builder.go")
+	args := []string{"-file", inputFile, "-type", "Person", "-output", outputFile}
+
+	if err := RunGenerator(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T)
+		wantErr   bool
+		wantDiffs []string
+	}{
+		{
+			name:  "up to date",
+			setup: func(t *testing.T) {},
+		},
+		{
+			name: "stale",
+			setup: func(t *testing.T) {
+				content, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stale := strings.Replace(string(content), "WithName", "WithFullName", 1)
+				if err := os.WriteFile(outputFile, []byte(stale), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:   true,
+			wantDiffs: []string{"--- " + outputFile, "-func (b *PersonBuilder) WithFullName", "+func (b *PersonBuilder) WithName"},
+		},
+		{
+			name: "missing",
+			setup: func(t *testing.T) {
+				if err := os.Remove(outputFile); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:   true,
+			wantDiffs: []string{"--- /dev/null", "+++ " + outputFile, "+type PersonBuilder struct"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+
+			var stdout bytes.Buffer
+			err := RunGenerator(append([]string{"-check"}, args...), &stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantDiffs {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("diff does not contain %q:\n%s", want, stdout.String())
+				}
+			}
+			if !tt.wantErr && stdout.Len() > 0 {
+				t.Errorf("unexpected diff:\n%s", stdout.String())
+			}
+		})
+	}
+
+	// Check mode never writes
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("check mode wrote %s", outputFile)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	inputFile := filepath.Join("..", "..", "cmd", "testdata", "person.go")
+	outputFile := filepath.Join(t.TempDir(), "person_builder.go")
+	args := []string{"-dry-run", "-file", inputFile, "-type", "Person", "-output", outputFile}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		want  string
+	}{
+		{
+			name:  "missing file",
+			setup: func(t *testing.T) {},
+			want:  "create    " + outputFile + " (-type Person)\n",
+		},
+		{
+			name: "stale file",
+			setup: func(t *testing.T) {
+				if err := os.WriteFile(outputFile, []byte("package testmodel\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "update    " + outputFile + " (-type Person)\n",
+		},
+		{
+			name: "up to date file",
+			setup: func(t *testing.T) {
+				if err := RunGenerator(args[1:], io.Discard); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "unchanged " + outputFile + " (-type Person)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			before, _ := os.ReadFile(outputFile)
+
+			var stdout bytes.Buffer
+			if err := RunGenerator(args, &stdout); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("dry run output = %q, want %q", stdout.String(), tt.want)
+			}
+
+			after, _ := os.ReadFile(outputFile)
+			if !bytes.Equal(before, after) {
+				t.Error("dry run modified the output file")
+			}
+		})
+	}
+}
+
+func TestRunStdout(t *testing.T) {
+	inputFile := filepath.Join("..", "..", "cmd", "testdata", "person.go")
+	outputFile := filepath.Join(t.TempDir(), "person_builder.go")
+
+	var stdout bytes.Buffer
+	err := RunGenerator([]string{"-stdout", "-file", inputFile, "-type", "Person", "-output", outputFile}, &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"// Code generated by nanostack/generator; DO NOT EDIT.",
+		"package testmodel",
+		"func (b *PersonBuilder) WithName(name string) *PersonBuilder",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("stdout does not contain %q:\n%s", want, stdout.String())
+		}
+	}
+
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("stdout mode wrote %s", outputFile)
+	}
+
+	if err := RunGenerator([]string{"-stdout", "-file", inputFile}, io.Discard); err == nil {
+		t.Error("expected an error for -stdout without -type")
+	}
+	if err := RunGenerator([]string{"-stdout", "-check", "-file", inputFile, "-type", "Person"}, io.Discard); err == nil {
+		t.Error("expected an error for -stdout combined with -check")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "model.go")
+	source := "package model\n\n// @builder\ntype Person struct{ Name string }\n\n// @builder\ntype Team struct{ Name string }\n"
+	if err := os.WriteFile(inputFile, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output directory does not exist, so every write fails
+	args := []string{"-file", inputFile, "-output", filepath.Join("missing", "{name}_builder.go")}
+
+	tests := []struct {
+		name      string
+		keepGoing bool
+		want      []string
+		notWant   []string
+	}{
+		{
+			name:    "fail fast",
+			want:    []string{inputFile + ":4:6: generating builder for Person"},
+			notWant: []string{"Team"},
+		},
+		{
+			name:      "keep going",
+			keepGoing: true,
+			want: []string{
+				"generation failed with 2 error(s)",
+				inputFile + ":4:6: generating builder for Person",
+				inputFile + ":7:6: generating builder for Team",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runArgs := args
+			if tt.keepGoing {
+				runArgs = append([]string{"-keep-going"}, args...)
+			}
+
+			err := RunGenerator(runArgs, io.Discard)
+			if err == nil {
+				t.Fatal("expected an error when the output directory is missing")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not contain %q:\n%v", want, err)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(err.Error(), notWant) {
+					t.Errorf("error should not contain %q:\n%v", notWant, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	source := `package model
+
+// @builder
+type Person struct{ Name string }
+
+// @builder
+type Team struct{ Name string }
+
+// @builder
+// @builder:prefix Add
+type Crew struct{ Name string }
+
+// @builder
+// @builder:prefix With
+type Band struct{ Name string }
+`
+	config := `{"prefix": "Set", "packages": {".": {"types": {"Team": {"prefix": "Put"}}}}}`
+	inputFile := filepath.Join(dir, "model.go")
+	if err := os.WriteFile(inputFile, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "configuration and annotations",
+			// The default prefix given as an annotation still overrides the
+			// configuration
+			want: map[string]string{"Person": "SetName", "Team": "PutName", "Crew": "AddName", "Band": "WithName"},
+		},
+		{
+			name: "explicit flag",
+			args: []string{"-prefix", "Use"},
+			want: map[string]string{"Person": "UseName", "Team": "UseName", "Crew": "UseName", "Band": "UseName"},
+		},
+		{
+			name: "explicit default flag",
+			args: []string{"-prefix", "With"},
+			want: map[string]string{"Person": "WithName", "Team": "WithName", "Crew": "WithName", "Band": "WithName"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RunGenerator(append(tt.args, "-file", inputFile), io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			for structName, method := range tt.want {
+				content, err := os.ReadFile(filepath.Join(dir, strings.ToLower(structName)+"_builder.go"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "func (b *" + structName + "Builder) " + method + "("
+				if !strings.Contains(string(content), want) {
+					t.Errorf("%s builder does not contain %q:\n%s", structName, want, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRunValidatePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	source := `package model
+
+// @builder
+type Person struct{ Name string }
+
+// @builder
+type Team struct{ Name string }
+
+// @builder
+// @builder:validate
+type Crew struct{ Name string }
+`
+	config := `{"validate": true, "packages": {".": {"types": {"Team": {"validate": false}}}}}`
+	inputFile := filepath.Join(dir, "model.go")
+	if err := os.WriteFile(inputFile, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want map[string]bool
+	}{
+		{
+			name: "configuration and annotations",
+			want: map[string]bool{"Person": true, "Team": false, "Crew": true},
+		},
+		{
+			name: "flag turning validation off",
+			args: []string{"-validate=false"},
+			want: map[string]bool{"Person": false, "Team": false, "Crew": false},
+		},
+		{
+			name: "flag turning validation on",
+			args: []string{"-validate"},
+			want: map[string]bool{"Person": true, "Team": true, "Crew": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RunGenerator(append(tt.args, "-file", inputFile), io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			for structName, validated := range tt.want {
+				content, err := os.ReadFile(filepath.Join(dir, strings.ToLower(structName)+"_builder.go"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.Contains(string(content), "Validate() error"); got != validated {
+					t.Errorf("%s builder validates = %t, want %t:\n%s", structName, got, validated, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRunParallelDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	var source strings.Builder
+	source.WriteString("package model\n")
+	for i := range 20 {
+		fmt.Fprintf(&source, "\n// @builder\n// @equal\n// @clone\ntype Model%d struct {\n\tName string\n\tTags []string\n}\n", i)
+	}
+	inputFile := filepath.Join(dir, "model.go")
+	if err := os.WriteFile(inputFile, []byte(source.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	generate := func(jobs string) map[string]string {
+		if err := RunGenerator([]string{"-j", jobs, "-file", inputFile}, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		var stdout bytes.Buffer
+		if err := RunGenerator([]string{"-j", jobs, "-dry-run", "-file", inputFile}, &stdout); err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]string{"dry-run": stdout.String()}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = string(content)
+			if entry.Name() != "model.go" {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return files
+	}
+
+	sequential := generate("1")
+	concurrent := generate("8")
+
+	// Builder, equal and clone files per struct, plus field_change.go and the source
+	if len(sequential) != 20*3+3 {
+		t.Errorf("got %d files, want %d", len(sequential), 20*3+3)
+	}
+	for name, content := range sequential {
+		if concurrent[name] != content {
+			t.Errorf("%s differs between -j 1 and -j 8", name)
+		}
+	}
+}
+
+func TestRunIncremental(t *testing.T) {
+	inputFile := filepath.Join("..", "..", "cmd", "testdata", "person.go")
+	outputFile := filepath.Join(t.TempDir(), "person_builder.go")
+	args := []string{"-file", inputFile, "-type", "Person", "-output", outputFile}
+
+	if err := RunGenerator(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	generated, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(generated), "// Generator inputs: sha256:") {
+		t.Fatalf("generated file does not record its input hash:\n%s", generated)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	setFile := func(t *testing.T, content string) {
+		t.Helper()
+		if err := os.WriteFile(outputFile, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(outputFile, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edited := strings.Replace(string(generated), "return b\n", "return b // edited\n", 1)
+
+	tests := []struct {
+		name        string
+		content     string
+		args        []string
+		wantContent func(content string) bool
+		wantWritten bool
+	}{
+		{
+			name:        "unchanged inputs",
+			content:     string(generated),
+			wantContent: func(content string) bool { return content == string(generated) },
+		},
+		{
+			name:        "edited output with unchanged inputs is not rendered",
+			content:     edited,
+			wantContent: func(content string) bool { return content == edited },
+		},
+		{
+			name:        "force",
+			content:     edited,
+			args:        []string{"-force"},
+			wantContent: func(content string) bool { return content == string(generated) },
+			wantWritten: true,
+		},
+		{
+			name:    "changed inputs",
+			content: string(generated),
+			args:    []string{"-prefix", "Set"},
+			wantContent: func(content string) bool {
+				return strings.Contains(content, "SetName(") && content != string(generated)
+			},
+			wantWritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFile(t, tt.content)
+
+			if err := RunGenerator(append(tt.args, args...), io.Discard); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantContent(string(content)) {
+				t.Errorf("unexpected content:\n%s", content)
+			}
+
+			info, err := os.Stat(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written := !info.ModTime().Equal(past); written != tt.wantWritten {
+				t.Errorf("file written = %v, want %v", written, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestRunPrune(t *testing.T) {
+	dir := t.TempDir()
+	orphan := "// Code generated by nanostack/generator; DO NOT EDIT.\n\npackage model\n\ntype TeamBuilder struct{}\n"
+	files := map[string]string{
+		"go.mod":                "module example.com/app\n\ngo 1.24\n",
+		"model/model.go":        "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+		"model/helper.go":       "package model\n\nfunc helper() {}\n",
+		"model/team_builder.go": orphan,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modelDir := filepath.Join(dir, "model")
+	orphanFile := filepath.Join(modelDir, "team_builder.go")
+	builderFile := filepath.Join(modelDir, "person_builder.go")
+
+	var stdout bytes.Buffer
+	if err := RunGenerator([]string{"-dir", dir, "-prune", "-dry-run"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if want := "delete    " + orphanFile + " (no longer generated)\n"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("dry run does not list %q:\n%s", want, stdout.String())
+	}
+	if _, err := os.Stat(orphanFile); err != nil {
+		t.Errorf("dry run deleted the orphaned file: %v", err)
+	}
+
+	if err := RunGenerator([]string{"-dir", dir, "-prune"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphanFile); !os.IsNotExist(err) {
+		t.Error("orphaned file was not pruned")
+	}
+	for _, kept := range []string{builderFile, filepath.Join(modelDir, "helper.go"), filepath.Join(modelDir, "model.go")} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("%s should be kept: %v", kept, err)
+		}
+	}
+
+	// A skipped struct no longer produces its builder
+	skipped := "package model\n\n// @builder\n// @builder:skip\ntype Person struct{ Name string }\n"
+	if err := os.WriteFile(filepath.Join(modelDir, "model.go"), []byte(skipped), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-prune", "-check"}, io.Discard); err == nil {
+		t.Error("check should report the builder of the skipped struct as stale")
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-prune"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(builderFile); !os.IsNotExist(err) {
+		t.Error("builder of the skipped struct was not pruned")
+	}
+
+	// Files of the packages excluded by the build tags are not orphans
+	tagged := "//go:build integration\n\npackage model\n\n// @builder\ntype Fixture struct{ Name string }\n"
+	if err := os.WriteFile(filepath.Join(modelDir, "fixture.go"), []byte(tagged), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-tags", "integration"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	fixtureFile := filepath.Join(modelDir, "fixture_builder.go")
+	stdout.Reset()
+	if err := RunGenerator([]string{"-dir", dir, "-prune", "-dry-run"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "delete") {
+		t.Errorf("dry run lists files excluded by the build tags:\n%s", stdout.String())
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-prune"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fixtureFile); err != nil {
+		t.Errorf("builder excluded by the build tags was pruned: %v", err)
+	}
+
+	if err := RunGenerator([]string{"-prune", "-file", filepath.Join(modelDir, "model.go")}, io.Discard); err == nil {
+		t.Error("expected an error for -prune with -file")
+	}
+}
+
+func TestRunSharedOutput(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.24\n",
+		// Declared first, but sorted after Person in the shared file
+		"model/a_team.go":   "package model\n\nimport \"time\"\n\n// @builder\ntype Team struct{ Founded time.Time }\n",
+		"model/b_person.go": "package model\n\nimport \"net/url\"\n\n// @builder\ntype Person struct{ Site url.URL }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outputFile := filepath.Join(dir, "model", "zz_generated_builders.go")
+
+	args := []string{"-dir", dir, "-output", "zz_generated_builders.go"}
+	if err := RunGenerator(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(content)
+	if n := strings.Count(code, generator.Header); n != 1 {
+		t.Errorf("expected one header, got %d", n)
+	}
+	if n := strings.Count(code, "import ("); n != 1 {
+		t.Errorf("expected one import block, got %d:\n%s", n, code)
+	}
+	for _, want := range []string{`"net/url"`, `"time"`, "func (b *PersonBuilder) WithSite(site url.URL)", "func (b *TeamBuilder) WithFounded(founded time.Time)"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("shared file is missing %q:\n%s", want, code)
+		}
+	}
+	if strings.Index(code, "type PersonBuilder") > strings.Index(code, "type TeamBuilder") {
+		t.Errorf("builders are not sorted by struct name:\n%s", code)
+	}
+
+	if err := RunGenerator(append(args, "-check"), io.Discard); err != nil {
+		t.Errorf("shared file should be up to date: %v", err)
+	}
+
+	// Only builders can share a file
+	options := "package model\n\n// @builder\n// @options\ntype Person struct{ Name string }\n"
+	if err := os.WriteFile(filepath.Join(dir, "model", "b_person.go"), []byte(options), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = RunGenerator([]string{"-dir", dir, "-output", "{name}_options.go"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "is also generated by") {
+		t.Errorf("expected an output collision error, got %v", err)
+	}
+}
+
+func TestRunOptionClash(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":            "module example.com/app\n\ngo 1.24\n",
+		"model/a_server.go": "package model\n\n// @options\ntype Server struct{ Name string }\n",
+		"model/b_client.go": "package model\n\n// @options\ntype Client struct {\n\tName string\n\tRetries int\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both structs would declare WithName in package model
+	err := RunGenerator([]string{"-dir", dir}, io.Discard)
+	if err == nil {
+		t.Fatal("expected an error for option funcs declared twice")
+	}
+	for _, want := range []string{"b_client.go:4:6: generating @options for Client", "option WithName is also generated for Server at", "a_server.go:4:6"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model", "client_options.go")); err == nil {
+		t.Error("the clashing options were generated")
+	}
+
+	// A prefix of its own tells the funcs of a struct apart
+	client := "package model\n\n// @options\n// @builder:prefix WithClient\ntype Client struct {\n\tName string\n\tRetries int\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "model", "b_client.go"), []byte(client), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "model", "client_options.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "func WithClientName(name string) ClientOption") {
+		t.Errorf("client options do not use the prefix:\n%s", content)
+	}
+}
+
+func TestRunHeaderAndBuildConstraint(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"generators.json": `{"headerFile": "header.tmpl"}`,
+		"header.tmpl":     "Copyright 2026 Acme.\n\n{{.Generator}} for {{.Types}} in {{.Sources}}, generator version {{.Version}}.\n",
+		"model/person.go": "//go:build integration\n\npackage model\n\n// @builder\n// @equal\ntype Person struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+
+	args := []string{"-dir", dir, "-tags", "integration"}
+	if err := RunGenerator(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(modelDir, "person_builder.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\n// Copyright 2026 Acme.\n//\n// builder for Person in person.go, generator version " + generator.Version + ".\n" +
+		"\n//go:build integration\n\npackage model\n"
+	if !strings.Contains(string(content), want) {
+		t.Errorf("builder does not contain %q:\n%s", want, content)
+	}
+	if !generator.IsGenerated(content) {
+		t.Error("builder no longer starts with the generated code header")
+	}
+
+	// Support files keep the header but not the constraint of a struct
+	content, err = os.ReadFile(filepath.Join(modelDir, "field_change.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "// equal for  in , generator") || strings.Contains(string(content), "//go:build") {
+		t.Errorf("unexpected support file preamble:\n%s", content)
+	}
+
+	if err := RunGenerator(append(args, "-check"), io.Discard); err != nil {
+		t.Errorf("generated files should be up to date: %v", err)
+	}
+	if err := RunGenerator(append(args, "-check", "-build-constraint", "integration && linux"), io.Discard); err == nil {
+		t.Error("check should report files generated with another build constraint")
+	}
+	if err := RunGenerator(append(args, "-build-constraint", "integration &&"), io.Discard); err == nil {
+		t.Error("expected an error for an invalid build constraint")
+	}
+}
+
+func TestRunRecordedFlags(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"header.tmpl":     "Copyright 2026 Acme.\n",
+		"model/person.go": "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+	builderFile := filepath.Join(modelDir, "person_builder.go")
+
+	args := []string{"-dir", dir, "-prefix", "Set", "-header-file", filepath.Join(dir, "header.tmpl")}
+	if err := RunGenerator(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(builderFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Paths are recorded relative to the generated directory
+	flags, ok := generator.RecordedFlags(content)
+	if want := "-prefix=Set -header-file=../header.tmpl"; !ok || strings.Join(flags, " ") != want {
+		t.Fatalf("RecordedFlags() = %q, %v, want %q", flags, ok, want)
+	}
+
+	// Planning with the recorded flags gives the recorded hash
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Join(modelDir, "person.go"), nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned, err := Plan(modelDir, genparser.ParseStructs(fset, file), flags)
+	if err != nil || len(planned) != 1 {
+		t.Fatalf("Plan() = %v, %v", planned, err)
+	}
+	if recorded, _ := generator.RecordedInputHash(content); planned[0].InputHash != recorded {
+		t.Errorf("planned hash %s, recorded %s", planned[0].InputHash, recorded)
+	}
+
+	// Flags are part of the inputs
+	if err := RunGenerator([]string{"-dir", dir, "-check", "-prefix", "Set"}, io.Discard); err == nil {
+		t.Error("check should report files generated with other flags")
+	}
+}
+
+func TestRunCloneAcrossFiles(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.24\n",
+		"model/a.go": "package model\n\n// @clone\ntype Address struct{ Lines []string }\n",
+		"model/p.go": "package model\n\n// @clone\ntype Person struct {\n\tAddr Address\n\tHome *Address\n\tList []Address\n}\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(modelDir, "person_clone.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Address is declared in another file, but still copies itself
+	for _, want := range []string{
+		"p.Addr.DeepCopyInto(&out.Addr)",
+		"out.Home = p.Home.Clone()",
+		"out[i] = *in[i].Clone()",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("person_clone.go does not contain %q:\n%s", want, content)
+		}
+	}
+
+	// Generating the file alone sees the other files of its package
+	if err := RunGenerator([]string{"-file", filepath.Join(modelDir, "p.go"), "-check"}, io.Discard); err != nil {
+		t.Errorf("check of the file alone: %v", err)
+	}
+}
+
+func TestRunSink(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"model/person.go": "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+	})
+	builderFile := filepath.Join(dir, "model", "person_builder.go")
+
+	cfg, err := parseConfig([]string{"-dir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &generator.MemorySink{}
+	cfg.sink = sink
+	if _, err := generate(cfg, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files go to the sink instead of the working tree
+	if names := sink.Names(); len(names) != 1 || names[0] != builderFile {
+		t.Errorf("sink holds %q, want %s", names, builderFile)
+	}
+	if content, _ := sink.ReadFile(builderFile); !strings.Contains(string(content), "type PersonBuilder struct") {
+		t.Errorf("unexpected builder:\n%s", content)
+	}
+	if _, err := os.Stat(builderFile); !os.IsNotExist(err) {
+		t.Errorf("builder written to disk: %v", err)
+	}
+}
+
+func TestRunCgoPackage(t *testing.T) {
+	t.Setenv("CGO_ENABLED", "1")
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"model/person.go": "package model\n\n// #include <stdlib.h>\nimport \"C\"\n\n// @builder\ntype Person struct{ Name string }\n",
+	})
+
+	// Builders go next to the source, not next to its cgo translation
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model", "person_builder.go")); err != nil {
+		t.Errorf("builder not written to the package: %v", err)
+	}
+}
+
+func TestRunPruneOtherGOOS(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":            "module example.com/app\n\ngo 1.24\n",
+		"model/model.go":    "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+		"model/winthing.go": "//go:build windows\n\npackage model\n\n// @builder\ntype WinThing struct{ Handle uintptr }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	winFile := filepath.Join(dir, "model", "winthing_builder.go")
+
+	t.Setenv("GOOS", "windows")
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(winFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "//go:build windows\n") {
+		t.Fatalf("builder does not keep the constraint of its source:\n%s", content)
+	}
+
+	// The builder copies the constraint of its source, so pruning for
+	// another GOOS must leave it alone
+	t.Setenv("GOOS", "linux")
+	var stdout bytes.Buffer
+	if err := RunGenerator([]string{"-dir", dir, "-prune", "-dry-run"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "delete") {
+		t.Errorf("dry run lists the builder of another GOOS:\n%s", stdout.String())
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-prune", "-check"}, io.Discard); err != nil {
+		t.Errorf("check reports the builder of another GOOS: %v", err)
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-prune"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run([]string{"clean", "-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(winFile); err != nil {
+		t.Errorf("builder of another GOOS was deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model", "person_builder.go")); !os.IsNotExist(err) {
+		t.Error("clean did not delete the builder of the current GOOS")
+	}
+}
+
+func TestRunTemplates(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"generators.json": `{"templates": "templates"}`,
+		"templates/builder/build.tmpl": `
+// Build returns the {{.Struct.Name}}, reporting it to the trace hook.
+func (b *{{.Struct.Name}}Builder) Build() *{{.Struct.Name}} {
+	traceBuild("{{.Struct.Name}}")
+	return b.instance
+}
+`,
+		"templates/builder/must_build.tmpl": `{{import "fmt"}}
+// MustBuild returns the {{.Struct.Name}}, panicking when it was not built.
+func (b *{{.Struct.Name}}Builder) MustBuild() *{{.Struct.Name}} {
+	if b.instance == nil {
+		panic(fmt.Sprintf("%s was not built", "{{.Struct.Name}}"))
+	}
+	return b.Build()
+}
+`,
+		"model/model.go": "package model\n\nfunc traceBuild(string) {}\n\n// @builder\n// @equal\ntype Person struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(modelDir, "person_builder.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`import "fmt"`,
+		"func (b *PersonBuilder) MustBuild() *Person {",
+		`traceBuild("Person")`,
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("builder does not contain %q:\n%s", want, content)
+		}
+	}
+	if n := strings.Count(string(content), ") Build() *Person"); n != 1 {
+		t.Errorf("expected the template to replace Build, found %d declarations:\n%s", n, content)
+	}
+	if !generator.IsGenerated(content) {
+		t.Error("builder no longer starts with the generated code header")
+	}
+
+	// Generators without templates are left alone
+	content, err = os.ReadFile(filepath.Join(modelDir, "person_equal.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "MustBuild") {
+		t.Errorf("builder templates were applied to the equal methods:\n%s", content)
+	}
+
+	if err := RunGenerator([]string{"-dir", dir, "-check"}, io.Discard); err != nil {
+		t.Errorf("generated files should be up to date: %v", err)
+	}
+	mustBuild := filepath.Join(dir, "templates", "builder", "must_build.tmpl")
+	if err := os.WriteFile(mustBuild, []byte("func (b *{{.Struct.Name}}Builder) MustBuild() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunGenerator([]string{"-dir", dir, "-check"}, io.Discard); err == nil {
+		t.Error("check should report files generated with other templates")
+	}
+	if err := os.WriteFile(mustBuild, []byte("func (b *{{.Struct.Name}}Builder) MustBuild( {\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunGenerator([]string{"-dir", dir}, io.Discard); err == nil || !strings.Contains(err.Error(), "must_build.tmpl") {
+		t.Errorf("expected an error naming the broken template, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"time"
+
+	genparser "github.com/nanostack-dev/generators/internal/builder/parser"
+	"github.com/nanostack-dev/generators/internal/builder/planner"
+)
+
+// File statuses given by -report, and by -dry-run for the statuses it
+// prints.
+const (
+	statusWritten   = "written"
+	statusUnchanged = "unchanged"
+	statusSkipped   = "skipped"
+	statusFailed    = "failed"
+	statusStale     = "stale"
+	statusRendered  = "rendered"
+	statusCreate    = "create"
+	statusUpdate    = "update"
+	statusDelete    = "delete"
+	statusDeleted   = "deleted"
+)
+
+// runReport is the summary of a run printed by -report json.
+type runReport struct {
+	// Mode is write, check or dry-run
+	Mode        string          `json:"mode"`
+	DurationMS  float64         `json:"duration_ms"`
+	Summary     reportSummary   `json:"summary"`
+	Packages    []packageReport `json:"packages"`
+	Files       []fileReport    `json:"files"`
+	Diagnostics []diagnostic    `json:"diagnostics"`
+}
+
+// reportSummary totals a run. Inputs counts the source files scanned,
+// leaving out the files the generators wrote.
+type reportSummary struct {
+	Inputs  int `json:"inputs"`
+	Structs int `json:"structs"`
+	// Files counts the files by status
+	Files map[string]int `json:"files"`
+}
+
+// packageReport describes a scanned package, with its inputs counted like
+// those of the summary. Its duration is the time
+// spent parsing its files and generating for its structs, summed over the
+// -j workers.
+type packageReport struct {
+	Dir        string  `json:"dir"`
+	ImportPath string  `json:"import_path,omitempty"`
+	Inputs     int     `json:"inputs"`
+	Structs    int     `json:"structs"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// fileReport is the outcome of a generated or deleted file.
+type fileReport struct {
+	Path      string   `json:"path"`
+	Generator string   `json:"generator,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	Status    string   `json:"status"`
+	Reason    string   `json:"reason"`
+}
+
+// diagnostic is a failure to generate for a struct, or to run at all when
+// it has no position.
+type diagnostic struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Generator string `json:"generator,omitempty"`
+	Message   string `json:"message"`
+}
+
+// newDiagnostic returns the diagnostic of generating what for structDef
+// failing with err.
+func newDiagnostic(structDef *genparser.StructDef, what string, err error) diagnostic {
+	return diagnostic{
+		File:      structDef.Position.Filename,
+		Line:      structDef.Position.Line,
+		Column:    structDef.Position.Column,
+		Type:      structDef.Name,
+		Generator: planner.GeneratorName(what),
+		Message:   err.Error(),
+	}
+}
+
+// reportGenerate generates for cfg and prints the summary of the run
+// instead of its usual output. The error of the run is returned after the
+// report is printed, so the exit status is unchanged.
+func reportGenerate(cfg config, stdout io.Writer) error {
+	start := time.Now()
+	g, err := generate(cfg, io.Discard)
+
+	report := runReport{
+		Mode:        "write",
+		Summary:     reportSummary{Files: make(map[string]int)},
+		Packages:    []packageReport{},
+		Files:       []fileReport{},
+		Diagnostics: []diagnostic{},
+	}
+	switch {
+	case cfg.check:
+		report.Mode = "check"
+	case cfg.dryRun:
+		report.Mode = "dry-run"
+	}
+
+	if g != nil {
+		report.Packages = append(report.Packages, g.packages...)
+		report.Files = append(report.Files, g.files...)
+		report.Diagnostics = append(report.Diagnostics, g.diagnostics...)
+	} else if err != nil {
+		report.Diagnostics = append(report.Diagnostics, diagnostic{Message: err.Error()})
+	}
+	for _, pkg := range report.Packages {
+		report.Summary.Inputs += pkg.Inputs
+		report.Summary.Structs += pkg.Structs
+	}
+	for _, file := range report.Files {
+		report.Summary.Files[file.Status]++
+	}
+	report.DurationMS = milliseconds(time.Since(start))
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return errors.Join(err, encoder.Encode(report))
+}
+
+// addPackage returns the report of the package in dir, adding it when it
+// is new. The import path is recorded when known.
+func (g *generation) addPackage(dir string, importPath string) *packageReport {
+	i, ok := g.packageIndex[dir]
+	if !ok {
+		i = len(g.packages)
+		g.packageIndex[dir] = i
+		g.packages = append(g.packages, packageReport{Dir: dir})
+	}
+	pkg := &g.packages[i]
+	if importPath != "" {
+		pkg.ImportPath = importPath
+	}
+	return pkg
+}
+
+// addDuration adds d to the time spent on the package.
+func (p *packageReport) addDuration(d time.Duration) {
+	p.DurationMS += milliseconds(d)
+}
+
+// recordFile adds the outcome of emitting file, which took d, to the
+// report.
+func (g *generation) recordFile(file *planner.File, result emitResult, d time.Duration) {
+	status := result.status
+	switch {
+	case result.err != nil:
+		status = statusFailed
+	case status == "":
+		// Not started after an earlier failure
+		status = statusSkipped
+	}
+
+	g.files = append(g.files, fileReport{
+		Path:      file.Path,
+		Generator: file.Generator,
+		Types:     file.Types(),
+		Status:    status,
+		Reason:    file.Reason,
+	})
+	g.addPackage(filepath.Dir(file.StructDefs[0].Position.Filename), "").addDuration(d)
+}
+
+// milliseconds returns d in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
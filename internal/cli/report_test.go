@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunReport(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.24\n",
+		"model/person.go": "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+		// The output directory does not exist
+		"model/team.go": "package model\n\n// @builder\n// @builder:output missing/{name}_builder.go\ntype Team struct{ Name string }\n",
+	})
+	modelDir := filepath.Join(dir, "model")
+
+	runReport := func(args ...string) (runReport, error) {
+		t.Helper()
+		var stdout bytes.Buffer
+		err := RunGenerator(append([]string{"-dir", dir, "-report", "json", "-keep-going"}, args...), &stdout)
+		var report runReport
+		if decodeErr := json.Unmarshal(stdout.Bytes(), &report); decodeErr != nil {
+			t.Fatalf("report is not JSON: %v\n%s", decodeErr, stdout.String())
+		}
+		return report, err
+	}
+
+	report, err := runReport()
+	if err == nil {
+		t.Error("expected the failure of the team builder")
+	}
+	if report.Mode != "write" || report.Summary.Inputs != 2 || report.Summary.Structs != 2 {
+		t.Errorf("unexpected summary: mode %s, %+v", report.Mode, report.Summary)
+	}
+	if report.Summary.Files[statusWritten] != 1 || report.Summary.Files[statusFailed] != 1 {
+		t.Errorf("expected one file written and one failed, got %v", report.Summary.Files)
+	}
+	if len(report.Packages) != 1 || report.Packages[0].ImportPath != "example.com/app/model" || report.Packages[0].Dir != modelDir {
+		t.Errorf("unexpected packages: %+v", report.Packages)
+	}
+
+	wantFile := fileReport{
+		Path:      filepath.Join(modelDir, "person_builder.go"),
+		Generator: "builder",
+		Types:     []string{"Person"},
+		Status:    statusWritten,
+		Reason:    "@builder on Person",
+	}
+	if len(report.Files) != 2 || report.Files[0].Path != wantFile.Path || report.Files[0].Status != wantFile.Status ||
+		report.Files[0].Generator != wantFile.Generator || report.Files[0].Reason != wantFile.Reason {
+		t.Errorf("unexpected files: %+v, want %+v first", report.Files, wantFile)
+	}
+
+	if len(report.Diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic, got %+v", report.Diagnostics)
+	}
+	d := report.Diagnostics[0]
+	if d.File != filepath.Join(modelDir, "team.go") || d.Line != 5 || d.Column != 6 || d.Type != "Team" || d.Generator != "builder" {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+
+	// The person builder written by the first run is not an input
+	report, _ = runReport("-check")
+	if report.Mode != "check" || report.Summary.Files[statusUnchanged] != 1 {
+		t.Errorf("expected the person builder to be unchanged in check mode, got %+v", report.Summary)
+	}
+	if report.Summary.Inputs != 2 || len(report.Packages) != 1 || report.Packages[0].Inputs != 2 {
+		t.Errorf("expected the two sources as inputs, got %+v and %+v", report.Summary, report.Packages)
+	}
+
+	if err := RunGenerator([]string{"-dir", dir, "-report", "yaml"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown report format")
+	}
+}
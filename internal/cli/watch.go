@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanostack-dev/generators/internal/builder/generator"
+)
+
+// fileStamp identifies a version of a file by its modification time and
+// size.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+// watch generates once for cfg, then polls the Go files of the generated
+// packages, or the file of -file, and regenerates the packages whose files
+// change until ctx is done. Changes are picked up once a poll finds no new
+// ones, so saving several files at once regenerates their package once.
+func watch(ctx context.Context, cfg config, stdout io.Writer) error {
+	g, err := generate(cfg, stdout)
+	if g == nil {
+		// Without packages there is nothing to watch
+		return err
+	}
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+	}
+
+	ctxt := build.Default
+	ctxt.BuildTags = cfg.buildTags()
+	scan := func() map[string]fileStamp {
+		if cfg.file != "" {
+			return stampFiles([]string{cfg.file})
+		}
+		return stampFiles(goFiles(&ctxt, g.dirs, g.produced))
+	}
+
+	stamps := scan()
+	fmt.Fprintf(stdout, "watching %d files for changes\n", len(stamps))
+
+	ticker := time.NewTicker(cfg.watchInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := scan()
+		changed := false
+		for path, stamp := range current {
+			if previous, ok := stamps[path]; !ok || previous != stamp {
+				pending[path] = true
+				changed = true
+			}
+		}
+		stamps = current
+
+		if changed || len(pending) == 0 {
+			continue
+		}
+
+		paths := make([]string, 0, len(pending))
+		for path := range pending {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		clear(pending)
+
+		// Paths are sorted, so the files of a directory are adjacent
+		for start := 0; start < len(paths); {
+			end := start + 1
+			for end < len(paths) && filepath.Dir(paths[end]) == filepath.Dir(paths[start]) {
+				end++
+			}
+			regenerate(cfg, paths[start:end], stdout)
+			start = end
+		}
+	}
+}
+
+// regenerate generates for the changed Go files at paths, all in the same
+// directory, and prints a status line. With -file only that file is
+// generated for; otherwise the package of the directory is, so builders
+// sharing an output file keep the structs declared in the other files.
+// Input hashes leave the files of unchanged structs alone. Generated files,
+// including the ones written by the previous regeneration, are ignored.
+func regenerate(cfg config, paths []string, stdout io.Writer) {
+	var changed []string
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil || generator.IsGenerated(content) {
+			continue
+		}
+		changed = append(changed, displayPath(path))
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	regenerateCfg := cfg
+	regenerateCfg.prune = false
+	if cfg.file == "" {
+		regenerateCfg.dir = filepath.Dir(paths[0])
+		regenerateCfg.patterns = []string{"."}
+	}
+	g, err := generate(regenerateCfg, io.Discard)
+
+	status := strings.Join(changed, ", ")
+	switch {
+	case err != nil:
+		fmt.Fprintf(stdout, "%s: %v\n", status, err)
+	case len(g.written) == 0:
+		fmt.Fprintf(stdout, "%s: up to date\n", status)
+	default:
+		written := make([]string, len(g.written))
+		for i, file := range g.written {
+			written[i] = displayPath(file)
+		}
+		fmt.Fprintf(stdout, "%s: wrote %s\n", status, strings.Join(written, ", "))
+	}
+}
+
+// goFiles returns the non-test Go files of dirs that match the build
+// constraints of ctxt, leaving out the generated files in skip.
+func goFiles(ctxt *build.Context, dirs []string, skip map[string]bool) []string {
+	var files []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if skip[path] {
+				continue
+			}
+			if match, err := ctxt.MatchFile(dir, name); err != nil || !match {
+				continue
+			}
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// stampFiles returns the current stamp of each of files that exists.
+func stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}
+	}
+	return stamps
+}
+
+// displayPath returns path relative to the working directory when it lies
+// below it, for shorter status lines.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
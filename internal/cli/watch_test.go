@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "model")
+	if err := os.MkdirAll(modelDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "go.mod"):          "module example.com/app\n\ngo 1.24\n",
+		filepath.Join(modelDir, "person.go"):  "package model\n\n// @builder\ntype Person struct{ Name string }\n",
+		filepath.Join(modelDir, "team.go"):    "package model\n\n// @builder\ntype Team struct{ Name string }\n",
+		filepath.Join(modelDir, "ignored.go"): "//go:build ignore\n\npackage model\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := parseConfig([]string{"-watch", "-watch-interval", "10ms", "-dir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	done := make(chan error)
+	go func() {
+		done <- watch(ctx, cfg, &stdout)
+	}()
+
+	waitFor := func(condition func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				cancel()
+				t.Fatalf("timed out, watch output:\n%s", stdout.String())
+			}
+		}
+	}
+
+	// Generated files and the ignored file are not watched
+	waitFor(func() bool { return strings.Contains(stdout.String(), "watching 2 files for changes") })
+
+	personBuilder := filepath.Join(modelDir, "person_builder.go")
+	teamBuilder := filepath.Join(modelDir, "team_builder.go")
+	teamInfo, err := os.Stat(teamBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := "package model\n\n// @builder\ntype Person struct {\n\tName string\n\tAge  int\n}\n"
+	if err := os.WriteFile(filepath.Join(modelDir, "person.go"), []byte(updated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(func() bool { return strings.Contains(stdout.String(), "person.go: wrote ") })
+	content, err := os.ReadFile(personBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "WithAge(age int)") {
+		t.Errorf("builder was not regenerated:\n%s", content)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the builders of the changed file are regenerated
+	if info, err := os.Stat(teamBuilder); err != nil || !info.ModTime().Equal(teamInfo.ModTime()) {
+		t.Errorf("team builder should be left alone: %v", err)
+	}
+	if strings.Contains(stdout.String(), "team.go") {
+		t.Errorf("team.go did not change:\n%s", stdout.String())
+	}
+}